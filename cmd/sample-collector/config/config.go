@@ -2,8 +2,11 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
 )
 
 type Config struct {
@@ -29,18 +32,43 @@ func LoadConfig(filePath string) (*Config, error) {
 		HTTPServerPort:         80,
 		RequestIntervalSeconds: 10}
 
-	f, err := os.Open(filePath)
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = json.NewDecoder(f).Decode(conf); err != nil {
+	if err = json.Unmarshal(data, conf); err != nil {
 		return nil, err
 	}
 
+	errs := config.UnknownKeys(data, conf)
+	errs = append(errs, conf.validate()...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	return conf, nil
 }
 
+func (c *Config) validate() config.ValidationError {
+	var errs config.ValidationError
+
+	if c.DBTestSamplesURL == "" {
+		errs = append(errs, config.FieldError{Path: "db_test_samples_url", Msg: "required"})
+	}
+	if c.ResultsURL == "" {
+		errs = append(errs, config.FieldError{Path: "results_url", Msg: "required"})
+	}
+	if c.HTTPServerPort <= 0 || c.HTTPServerPort > 65535 {
+		errs = append(errs, config.FieldError{Path: "http_server_port", Msg: fmt.Sprintf("must be 1-65535, got %d", c.HTTPServerPort)})
+	}
+	if c.RequestIntervalSeconds <= 0 {
+		errs = append(errs, config.FieldError{Path: "request_interval_seconds", Msg: fmt.Sprintf("must be greater than 0, got %d", c.RequestIntervalSeconds)})
+	}
+
+	return errs
+}
+
 // fileExists checks if a file exists and is not a directory before we try using it to prevent further errors.
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
@@ -12,6 +12,7 @@ import (
 func main() {
 	svcFlag := flag.String("service", "", "Control the system service.")
 	confFlag := flag.String("c", "sample-collector-config.json", "Specify config -c=sample-collector-config.json")
+	checkFlag := flag.Bool("check-config", false, "Validate config and exit. Exits non-zero on errors.")
 	flag.Parse()
 
 	conf, err := config.LoadConfig(*confFlag)
@@ -19,6 +20,11 @@ func main() {
 		log.Fatal("error parsing config '"+*confFlag+"': ", err)
 	}
 
+	if *checkFlag {
+		log.Println("config '" + *confFlag + "' is valid")
+		return
+	}
+
 	svcConfig := &service.Config{
 		Name:        "SampleCollector",
 		DisplayName: "Spectro Test Samples Data Collector",
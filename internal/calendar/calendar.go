@@ -0,0 +1,100 @@
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const week = 7 * 24 * time.Hour
+
+// Window is a period of planned downtime for a furnace.
+type Window struct {
+	Furnace string // empty for all furnaces
+	Start   time.Time
+	End     time.Time
+	Reason  string
+
+	Weekly bool      // repeat every week from Start
+	Until  time.Time // last repetition of weekly window. zero for forever
+}
+
+func (w *Window) contains(t time.Time) bool {
+	if t.Before(w.Start) {
+		return false
+	}
+
+	if !w.Weekly {
+		return t.Before(w.End)
+	}
+
+	d := t.Sub(w.Start) % week
+	if d >= w.End.Sub(w.Start) {
+		return false
+	}
+
+	// t-d is the start of this repetition
+	return w.Until.IsZero() || !t.Add(-d).After(w.Until)
+}
+
+// Calendar of planned furnace downtime.
+type Calendar struct {
+	windows []Window
+}
+
+func New(windows []Window) *Calendar {
+	return &Calendar{windows: windows}
+}
+
+// Down returns the downtime window furnace is in at time t, if any.
+func (c *Calendar) Down(furnace string, t time.Time) (*Window, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	for i := range c.windows {
+		w := &c.windows[i]
+		if w.Furnace != "" && w.Furnace != furnace {
+			continue
+		}
+
+		if w.contains(t) {
+			return w, true
+		}
+	}
+
+	return nil, false
+}
+
+// LoadFile imports downtime windows from a .csv or iCal (.ics) file.
+func LoadFile(filePath string) ([]Window, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".csv":
+		return loadCSV(filePath)
+	case ".ics", ".ical":
+		return loadICal(filePath)
+	default:
+		return nil, errors.New("unknown downtime calendar file type: " + filePath)
+	}
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parse time in RFC3339 or local time
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, l := range timeLayouts {
+		if t, err := time.ParseInLocation(l, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time '%s'", s)
+}
@@ -0,0 +1,147 @@
+package calendar
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func utc(day, hour, min int) time.Time {
+	return time.Date(2024, time.January, day, hour, min, 0, 0, time.UTC)
+}
+
+func local(day, hour, min int) time.Time {
+	return time.Date(2024, time.January, day, hour, min, 0, 0, time.Local)
+}
+
+func checkWindows(t *testing.T, got, want []Window) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d windows, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Furnace != w.Furnace || !g.Start.Equal(w.Start) || !g.End.Equal(w.End) || g.Reason != w.Reason ||
+			g.Weekly != w.Weekly || !g.Until.Equal(w.Until) {
+			t.Errorf("window %d:\ngot  %+v\nwant %+v", i, g, w)
+		}
+	}
+}
+
+func TestLoadCSV(t *testing.T) {
+	got, err := LoadFile(filepath.Join("testdata", "downtime.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sast := time.FixedZone("", 2*60*60)
+	checkWindows(t, got, []Window{
+		{Furnace: "HF1", Start: local(5, 14, 0), End: local(5, 18, 0), Reason: "relining"},
+		{Start: local(10, 0, 0), End: local(11, 0, 0)},
+		{
+			Furnace: "HF2",
+			Start:   time.Date(2024, time.January, 12, 6, 0, 0, 0, sast),
+			End:     time.Date(2024, time.January, 12, 8, 0, 0, 0, sast),
+			Reason:  "power, outage",
+		},
+	})
+}
+
+func TestLoadICal(t *testing.T) {
+	got, err := LoadFile(filepath.Join("testdata", "downtime.ics"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 14:00 in Africa/Johannesburg
+	checkWindows(t, got, []Window{
+		{
+			Furnace: "HF3",
+			Start:   utc(6, 12, 0),
+			End:     utc(8, 4, 0),
+			Reason:  "Weekend shutdown",
+			Weekly:  true,
+			Until:   time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{Start: local(15, 0, 0), End: local(16, 0, 0), Reason: "Plant maintenance, all furnaces"},
+	})
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"byday_mismatch.ics", "BYDAY 'SA' other than weekday of DTSTART"},
+		{"multiple_days.ics", "multiple days"},
+		{"daily.ics", "unsupported RRULE frequency 'DAILY'"},
+		{"short_row.csv", "line 2: expected furnace,start,end"},
+		{"downtime.txt", "unknown downtime calendar file type"},
+	}
+
+	for _, tt := range tests {
+		_, err := LoadFile(filepath.Join("testdata", tt.file))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want it to contain %q", tt.file, err, tt.want)
+		}
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	once := Window{Start: utc(5, 14, 0), End: utc(5, 18, 0)}
+
+	// Saturday 14:00 to Monday 06:00, last starting 20 January
+	weekly := Window{Start: utc(6, 14, 0), End: utc(8, 6, 0), Weekly: true, Until: utc(20, 14, 0)}
+	forever := weekly
+	forever.Until = time.Time{}
+
+	tests := []struct {
+		name string
+		w    *Window
+		t    time.Time
+		want bool
+	}{
+		{"before", &once, utc(5, 13, 59), false},
+		{"start", &once, utc(5, 14, 0), true},
+		{"during", &once, utc(5, 17, 59), true},
+		{"end", &once, utc(5, 18, 0), false},
+		{"next week", &once, utc(12, 15, 0), false},
+
+		{"weekly before first", &weekly, utc(6, 13, 0), false},
+		{"weekly first", &weekly, utc(7, 12, 0), true},
+		{"weekly end", &weekly, utc(8, 6, 0), false},
+		{"weekly midweek", &weekly, utc(10, 12, 0), false},
+		{"weekly second", &weekly, utc(13, 14, 0), true},
+		{"weekly last starts at until", &weekly, utc(21, 23, 0), true},
+		{"weekly after until", &weekly, utc(27, 15, 0), false},
+		{"weekly forever", &forever, utc(28, 1, 0), true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.w.contains(tt.t); got != tt.want {
+			t.Errorf("%s: contains(%s) = %t, want %t", tt.name, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestDown(t *testing.T) {
+	c := New([]Window{
+		{Furnace: "HF1", Start: utc(5, 14, 0), End: utc(5, 18, 0), Reason: "relining"},
+		{Start: utc(10, 0, 0), End: utc(11, 0, 0), Reason: "plant"},
+	})
+
+	if w, ok := c.Down("HF1", utc(5, 15, 0)); !ok || w.Reason != "relining" {
+		t.Errorf("HF1 not down for relining: %v, %t", w, ok)
+	}
+	if _, ok := c.Down("HF2", utc(5, 15, 0)); ok {
+		t.Error("HF2 down in window of HF1")
+	}
+	if w, ok := c.Down("HF2", utc(10, 12, 0)); !ok || w.Reason != "plant" {
+		t.Errorf("HF2 not down in window of all furnaces: %v, %t", w, ok)
+	}
+	if _, ok := (*Calendar)(nil).Down("HF1", utc(5, 15, 0)); ok {
+		t.Error("down without calendar")
+	}
+}
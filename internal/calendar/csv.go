@@ -0,0 +1,59 @@
+package calendar
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CSV columns: furnace,start,end[,reason]
+// Empty or '*' furnace applies to all furnaces.
+func loadCSV(filePath string) ([]Window, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	windows := make([]Window, 0, len(records))
+	for i, rec := range records {
+		if i == 0 && strings.EqualFold(rec[0], "furnace") {
+			continue // header
+		}
+
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("%s line %d: expected furnace,start,end[,reason]", filePath, i+1)
+		}
+
+		var w Window
+		if rec[0] != "*" {
+			w.Furnace = strings.TrimSpace(rec[0])
+		}
+
+		if w.Start, err = parseTime(rec[1]); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", filePath, i+1, err)
+		}
+		if w.End, err = parseTime(rec[2]); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", filePath, i+1, err)
+		}
+
+		if len(rec) > 3 {
+			w.Reason = strings.TrimSpace(rec[3])
+		}
+
+		windows = append(windows, w)
+	}
+
+	return windows, nil
+}
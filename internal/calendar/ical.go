@@ -0,0 +1,167 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Minimal iCalendar import of VEVENTs. LOCATION is taken as the furnace name,
+// events without one apply to all furnaces. Only weekly RRULEs on the weekday of DTSTART are supported.
+func loadICal(filePath string) ([]Window, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// unfold continuation lines
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := strings.TrimRight(s.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, l)
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+
+	var windows []Window
+	var w *Window
+	var dateOnly bool
+	var byDay string // of RRULE, checked against DTSTART once event is read
+
+	for i, l := range lines {
+		name, params, value, ok := splitProperty(l)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			w, dateOnly, byDay = &Window{}, false, ""
+		case w == nil:
+			continue
+		case name == "END" && value == "VEVENT":
+			if w.End.IsZero() && dateOnly {
+				w.End = w.Start.AddDate(0, 0, 1)
+			}
+
+			if w.Start.IsZero() || !w.End.After(w.Start) {
+				return nil, fmt.Errorf("%s line %d: event without valid DTSTART/DTEND", filePath, i+1)
+			}
+
+			// weekly windows repeat on DTSTART's weekday
+			if byDay != "" && byDay != icalDays[w.Start.Weekday()] {
+				return nil, fmt.Errorf("%s line %d: unsupported RRULE BYDAY '%s' other than weekday of DTSTART", filePath, i+1, byDay)
+			}
+
+			windows = append(windows, *w)
+			w = nil
+		case name == "DTSTART":
+			if w.Start, err = parseICalTime(params, value); err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", filePath, i+1, err)
+			}
+			dateOnly = len(value) == 8
+		case name == "DTEND":
+			if w.End, err = parseICalTime(params, value); err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", filePath, i+1, err)
+			}
+		case name == "SUMMARY":
+			w.Reason = unescapeText(value)
+		case name == "LOCATION":
+			w.Furnace = unescapeText(value)
+		case name == "RRULE":
+			if byDay, err = parseRRule(w, value); err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", filePath, i+1, err)
+			}
+		}
+	}
+
+	return windows, nil
+}
+
+// NAME;PARAM=x;PARAM=y:VALUE
+func splitProperty(l string) (name string, params map[string]string, value string, ok bool) {
+	colon := strings.IndexByte(l, ':')
+	if colon < 0 {
+		return
+	}
+
+	parts := strings.Split(l[:colon], ";")
+	name = strings.ToUpper(parts[0])
+	params = make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		if k, v, found := strings.Cut(p, "="); found {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+
+	return name, params, l[colon+1:], true
+}
+
+func parseICalTime(params map[string]string, value string) (time.Time, error) {
+	if len(value) == 8 {
+		return time.ParseInLocation("20060102", value, time.Local)
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		l, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, err
+		}
+		loc = l
+	}
+
+	return time.ParseInLocation("20060102T150405", value, loc)
+}
+
+var icalDays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// parse weekly RRULE into w, returning its BYDAY if any
+func parseRRule(w *Window, rule string) (byDay string, err error) {
+	for _, p := range strings.Split(rule, ";") {
+		k, v, _ := strings.Cut(p, "=")
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			if strings.ToUpper(v) != "WEEKLY" {
+				return "", fmt.Errorf("unsupported RRULE frequency '%s'", v)
+			}
+			w.Weekly = true
+		case "UNTIL":
+			if w.Until, err = parseICalTime(nil, v); err != nil {
+				return "", err
+			}
+		case "INTERVAL":
+			if v != "1" {
+				return "", fmt.Errorf("unsupported RRULE interval '%s'", v)
+			}
+		case "BYDAY":
+			// only the weekday of DTSTART, which may not have been read yet
+			if strings.Contains(v, ",") {
+				return "", fmt.Errorf("unsupported RRULE with multiple days '%s'", v)
+			}
+			byDay = strings.ToUpper(v)
+		case "WKST":
+		default:
+			return "", fmt.Errorf("unsupported RRULE part '%s'", p)
+		}
+	}
+
+	return byDay, nil
+}
+
+func unescapeText(s string) string {
+	return strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(s)
+}
@@ -3,29 +3,328 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"slices"
+	"time"
 )
 
 type Config struct {
-	ModbusURL          string `json:"modbus_url"`
-	ModbusAddrLights   uint16 `json:"modbus_address_start_lights"`
-	ModbusAddrDisplays uint16 `json:"modbus_address_start_displays"`
+	// single PLC, if plcs is omitted. see PLC for addresses
+	ModbusURL                string  `json:"modbus_url"`
+	ModbusAddrLights         uint16  `json:"modbus_address_start_lights"`
+	ModbusAddrDisplays       uint16  `json:"modbus_address_start_displays"`
+	ModbusAddrAckInputs      *uint16 `json:"modbus_address_start_ack_inputs"`
+	ModbusAddrHeartbeatOut   *uint16 `json:"modbus_address_heartbeat_out"`
+	ModbusAddrHeartbeatIn    *uint16 `json:"modbus_address_heartbeat_in"`
+	ModbusAddrCommsFaultCoil *uint16 `json:"modbus_address_comms_fault_coil"`
+	ModbusClient
+
+	PLCs []PLC `json:"plcs"` // named PLC connections, referenced by furnaces
+
+	OutputSinks []OutputSink `json:"output_sinks"` // where furnace lights and display text are sent. Default PLCs only
+
+	ModbusVerifyWrites  bool `json:"modbus_verify_writes"` // read back lights and displays after writing
+	ModbusVerifyRetries int  `json:"modbus_verify_retries"`
+
+	AckInputType      string `json:"ack_input_type"` // "discrete_input" or "holding_register"
+	AckPollIntervalMs int    `json:"ack_poll_interval_ms"`
+	AckSilenceMinutes int    `json:"ack_silence_minutes"` // time flashing alarm is held steady after acknowledge
+
+	HornEscalation HornEscalation `json:"horn_escalation"`  // sound horn_coil of furnaces red too long
+	HornQuietHours []QuietHours   `json:"horn_quiet_hours"` // horns stay silent, including state_outputs pulses
+
+	HeartbeatIntervalSeconds   int `json:"heartbeat_interval_seconds"`
+	PLCHeartbeatTimeoutSeconds int `json:"plc_heartbeat_timeout_seconds"` // alarm if PLC heartbeat unchanged this long
 
 	LogFilePath string `json:"log_file_path"`
 
+	StatusHTTPAddr string `json:"status_http_addr"` // e.g. "127.0.0.1:8080" for local status page and metrics. Omit to disable
+
+	ModbusServerURL string `json:"modbus_server_url"` // e.g. "tcp://0.0.0.0:5020" for SCADA to poll furnace state. Omit to disable
+
+	MQTT MQTT `json:"mqtt"` // publish furnace state to MQTT broker
+
+	// result server unreachable
+	CommsLostAfterFailedPolls int    `json:"comms_lost_after_failed_polls"`
+	CommsLostDisplayText      string `json:"comms_lost_display_text"`
+
+	plcsFromTopLevel bool // single PLC from top level modbus settings
+
 	TransferSamplesOnly           bool      `json:"transfer_samples_only"`
 	ResultUrl                     string    `json:"result_url"`
+	ResultStreamUrl               string    `json:"result_stream_url"`        // optional SSE stream of new results, with keepalive comments at least every request interval. polling is fallback
 	RequestIntervalSeconds        int       `json:"request_interval_seconds"` // time between requests
 	DisplayBoardUpdateRateSeconds int       `json:"display_board_update_rate_seconds"`
+	DisplayPageSeconds            int       `json:"display_page_seconds"` // time each display page is shown
+	DisplaySlotBytes              int       `json:"display_slot_bytes"`   // PLC register bytes per display board, for PLCs without their own
 	TimeUpdateUrl                 string    `json:"time_update_url"`
 	TimeUpdateIntervalSeconds     int       `json:"time_update_interval_seconds"`
-	FurnaceResultOldTimeMinutes   int       `json:"furnace_result_old_time_minutes"` // time in minutes after sample is old
-	Furnaces                      []furnace `json:"furnaces"`
+	TimeSyncSource                string    `json:"time_sync_source"`                // "http" (time_update_url), "sntp" or "none"
+	SNTPServer                    string    `json:"sntp_server"`                     // host[:port]
+	TimeSyncMode                  string    `json:"time_sync_mode"`                  // "set_clock" or "offset_only", which requires compensate_clock_skew
+	CompensateClockSkew           bool      `json:"compensate_clock_skew"`           // correct sample ages for difference between result server's clock and ours
+	FurnaceResultOldTimeMinutes   int       `json:"furnace_result_old_time_minutes"` // default alarm age for furnaces that don't specify one
+	LightFlashIntervalMs          int       `json:"light_flash_interval_ms"`         // on/off time of flashing lights
+	Furnaces                      []Furnace `json:"furnaces"`
+
+	DowntimeCalendarFiles []string `json:"downtime_calendar_files"` // .csv or .ics imports of planned furnace downtime
+	DowntimeDisplayText   string   `json:"downtime_display_text"`   // shown on display board during downtime
+}
+
+const (
+	DisplayPageTime    = "time"    // time since last sample
+	DisplayPageSample  = "sample"  // last sample name
+	DisplayPageElement = "element" // last sample's display_element value
+)
+
+const (
+	TimeSyncHTTP = "http"
+	TimeSyncSNTP = "sntp"
+	TimeSyncNone = "none"
+
+	TimeSyncSetClock   = "set_clock"   // step system clock
+	TimeSyncOffsetOnly = "offset_only" // never touch system clock, only correct sample ages
+)
+
+const (
+	AckDiscreteInput   = "discrete_input"
+	AckHoldingRegister = "holding_register"
+)
+
+// PLC is a Modbus connection to a Delta PLC driving lights and display boards
+// of the furnaces referencing it. Blocks of coils and registers are per furnace,
+// in order of furnaces on this PLC.
+type PLC struct {
+	Name      string `json:"name"`
+	ModbusURL string `json:"modbus_url"` // tcp://host:port, tcp+tls://host:port or rtu:///dev/ttyUSB0
+	ModbusClient
+
+	ModbusAddrLights   uint16 `json:"modbus_address_start_lights"`
+	ModbusAddrDisplays uint16 `json:"modbus_address_start_displays"`
+	DisplaySlotBytes   int    `json:"display_slot_bytes"` // register bytes per display board. Default top level display_slot_bytes
+
+	ModbusAddrAckInputs *uint16 `json:"modbus_address_start_ack_inputs"` // one acknowledge button per furnace. Omit to disable
+
+	// heartbeat registers so PLC and spectromon can detect each other dying
+	ModbusAddrHeartbeatOut *uint16 `json:"modbus_address_heartbeat_out"` // incremented every interval. Omit to disable
+	ModbusAddrHeartbeatIn  *uint16 `json:"modbus_address_heartbeat_in"`  // incremented by PLC. Omit to disable
+
+	ModbusAddrCommsFaultCoil *uint16 `json:"modbus_address_comms_fault_coil"` // on while result server comms lost. Omit to disable
 }
 
-type furnace struct {
+// ModbusClient settings of a PLC connection. Zero values suit a Delta PLC.
+type ModbusClient struct {
+	// serial line, rtu:// only
+	BaudRate uint   `json:"baud_rate"` // default 19200
+	DataBits uint   `json:"data_bits"` // default 8
+	Parity   string `json:"parity"`    // "none" (default), "even" or "odd"
+	StopBits uint   `json:"stop_bits"` // default 2 without parity, otherwise 1
+
+	UnitID    uint8 `json:"unit_id"`    // default 1
+	TimeoutMs int   `json:"timeout_ms"` // default 5000
+
+	// PEM files, tcp+tls:// only. All required
+	TLSCertFile string `json:"tls_cert_file"` // client certificate
+	TLSKeyFile  string `json:"tls_key_file"`
+	TLSCAFile   string `json:"tls_ca_file"` // CAs or PLC's own certificate to verify PLC with
+
+	Endianness string `json:"endianness"`  // byte order in registers: "little" (default, Delta) or "big"
+	WordOrder  string `json:"word_order"`  // "high_word_first" (default, Delta) or "low_word_first"
+	OutputType string `json:"output_type"` // lights and comms fault outputs: "coil" (default) or "holding_register", one per output
+}
+
+const (
+	ParityNone = "none"
+	ParityEven = "even"
+	ParityOdd  = "odd"
+
+	LittleEndian = "little"
+	BigEndian    = "big"
+
+	HighWordFirst = "high_word_first"
+	LowWordFirst  = "low_word_first"
+
+	OutputCoil            = "coil"
+	OutputHoldingRegister = "holding_register"
+)
+
+// OutputSink is a destination for furnace lights and display board text.
+// Several sinks can be used at once, e.g. to mirror PLC output to other andon hardware.
+type OutputSink struct {
+	Type string `json:"type"` // "plc", "log" or "webhook"
+
+	// webhook only
+	URL       string `json:"url"`        // receives POST of JSON furnace state on state or light change
+	TimeoutMs int    `json:"timeout_ms"` // default 5000
+}
+
+const (
+	SinkPLC     = "plc"     // lights and display boards of furnaces on each PLC in plcs
+	SinkLog     = "log"     // furnace state changes in log
+	SinkWebhook = "webhook" // JSON over HTTP
+)
+
+// MQTT broker that furnace state is published to, retained on spectro/<site>/<furnace>/state.
+// spectro/<site>/status is "online" while connected, and "offline" as last will.
+type MQTT struct {
+	BrokerURL string `json:"broker_url"` // tcp://host:1883 or ssl://host:8883. Omit to disable
+	Site      string `json:"site"`       // topic level for this spectromon, e.g. "meltshop"
+	ClientID  string `json:"client_id"`  // default "spectromon-<site>"
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+
+	// PEM files, ssl:// or wss:// only
+	TLSCertFile string `json:"tls_cert_file"` // client certificate, if broker requires one
+	TLSKeyFile  string `json:"tls_key_file"`
+	TLSCAFile   string `json:"tls_ca_file"` // CAs to verify broker with. Omit for system CAs
+}
+
+// name of PLC made from top level modbus settings
+const DefaultPLC = "default"
+
+type Furnace struct {
 	Name string `json:"name"`
+	PLC  string `json:"plc"` // name of PLC in plcs. Omit for first
+
+	DisplayBoardAddress uint8    `json:"display_board_address"`
+	DisplayProtocol     string   `json:"display_protocol"` // "standard" or "alpha"
+	DisplayPages        []string `json:"display_pages"`    // rotating pages: "time", "sample", "element"
+	DisplayElement      string   `json:"display_element"`  // element shown on "element" page, e.g. "C"
+
+	WarningAgeMinutes int `json:"warning_age_minutes"` // time in minutes after sample is due soon (amber)
+	AlarmAgeMinutes   int `json:"alarm_age_minutes"`   // time in minutes after sample is old (red)
+
+	AlarmFlashAfterMinutes int `json:"alarm_flash_after_minutes"` // flash red light this long past alarm age. 0 to disable
+
+	Downtime []downtimeWindow `json:"downtime"` // planned downtime, lights off and no alarm
+
+	// coils on furnace's PLC driven in each state, by state name, e.g. for stack lights with a horn.
+	// replaces furnace's red, green and amber block at modbus_address_start_lights. Omit for block
+	StateOutputs map[string]StateOutput `json:"state_outputs"`
+	HornCoil     *uint16                `json:"horn_coil"` // pulsed per state_outputs and horn_escalation
+}
+
+// StateOutput is what a furnace drives while in a state, see Furnace.StateOutputs.
+type StateOutput struct {
+	On    []uint16 `json:"on"`    // coils on
+	Flash []uint16 `json:"flash"` // coils flashing. In alarm, they flash only while red light would, until acknowledged
+
+	HornPulseMs int `json:"horn_pulse_ms"` // horn_coil on this long on entering state. 0 for none
+}
+
+// HornEscalation sounds a furnace's horn_coil in a pattern once it has been red (alarm) for a while,
+// repeating until a sample arrives or the alarm is acknowledged.
+type HornEscalation struct {
+	AfterMinutes  int   `json:"after_minutes"`  // red this long before horn sounds
+	PulseMs       []int `json:"pulse_ms"`       // pattern of horn on, off, on... times. Omit to disable
+	RepeatMinutes int   `json:"repeat_minutes"` // pattern starts again this often. 0 to sound once
+}
 
-	DisplayBoardAddress uint8 `json:"display_board_address"`
+func (h *HornEscalation) After() time.Duration {
+	return time.Duration(h.AfterMinutes) * time.Minute
+}
+
+func (h *HornEscalation) Repeat() time.Duration {
+	return time.Duration(h.RepeatMinutes) * time.Minute
+}
+
+// PatternOn reports whether horn is on at d into pulse pattern.
+func (h *HornEscalation) PatternOn(d time.Duration) bool {
+	for i, ms := range h.PulseMs {
+		if d -= time.Duration(ms) * time.Millisecond; d < 0 {
+			return i%2 == 0
+		}
+	}
+	return false
+}
+
+// PatternLen is the total time of the pulse pattern.
+func (h *HornEscalation) PatternLen() time.Duration {
+	var d time.Duration
+	for _, ms := range h.PulseMs {
+		d += time.Duration(ms) * time.Millisecond
+	}
+	return d
+}
+
+// QuietHours is a daily window of local time, e.g. 22:00 to 06:00.
+type QuietHours struct {
+	Start string `json:"start"` // "15:04"
+	End   string `json:"end"`   // before start for a window past midnight
+
+	start, end int // minutes into day, set by LoadConfig. -1 if not HH:MM
+}
+
+// Contains reports whether t's local time of day is in window.
+func (q *QuietHours) Contains(t time.Time) bool {
+	if q.start < 0 || q.end < 0 {
+		return false // reported by Validate
+	}
+
+	tod := t.Hour()*60 + t.Minute()
+	if q.start <= q.end {
+		return tod >= q.start && tod < q.end
+	}
+	return tod >= q.start || tod < q.end
+}
+
+// minutes into day of "15:04", or -1
+func minuteOfDay(s string) int {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return -1
+	}
+	return t.Hour()*60 + t.Minute()
+}
+
+// InQuietHours reports whether horns are to stay silent at t.
+func (c *Config) InQuietHours(t time.Time) bool {
+	for i := range c.HornQuietHours {
+		if c.HornQuietHours[i].Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// furnace states, as in state_outputs and status
+var FurnaceStates = []string{"no_result", "ok", "warning", "alarm", "downtime", "comms_lost"}
+
+type downtimeWindow struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason"`
+
+	RepeatWeekly bool      `json:"repeat_weekly"`
+	RepeatUntil  time.Time `json:"repeat_until"`
+}
+
+func (f *Furnace) WarningAge() time.Duration {
+	return time.Duration(f.WarningAgeMinutes) * time.Minute
+}
+
+func (f *Furnace) AlarmAge() time.Duration {
+	return time.Duration(f.AlarmAgeMinutes) * time.Minute
+}
+
+func (f *Furnace) AlarmFlashAfter() time.Duration {
+	return time.Duration(f.AlarmFlashAfterMinutes) * time.Minute
+}
+
+// PLCIndex returns the index of named PLC in PLCs, or -1.
+func (c *Config) PLCIndex(name string) int {
+	return slices.IndexFunc(c.PLCs, func(p PLC) bool { return p.Name == name })
+}
+
+// FurnacesOn returns indexes of furnaces on PLC, in order of their display slots and ack inputs.
+// Furnaces without state_outputs also have a block of lights, in the same order.
+func (c *Config) FurnacesOn(plc string) []int {
+	var idx []int
+	for i := range c.Furnaces {
+		if c.Furnaces[i].PLC == plc {
+			idx = append(idx, i)
+		}
+	}
+	return idx
 }
 
 func LoadConfig(filePath string) (*Config, error) {
@@ -33,16 +332,108 @@ func LoadConfig(filePath string) (*Config, error) {
 		ResultUrl:                     "localhost/lastfurnaceresults",
 		RequestIntervalSeconds:        25,
 		DisplayBoardUpdateRateSeconds: 1,
+		DisplayPageSeconds:            5,
+		DisplaySlotBytes:              16,
 		TimeUpdateIntervalSeconds:     60 * 5,
+		CompensateClockSkew:           true,
+		TimeSyncSource:                TimeSyncHTTP,
+		TimeSyncMode:                  TimeSyncSetClock,
 		FurnaceResultOldTimeMinutes:   60 * 3,
+		LightFlashIntervalMs:          500,
+		DowntimeDisplayText:           "OFF",
+		ModbusVerifyRetries:           2,
+		AckInputType:                  AckDiscreteInput,
+		AckPollIntervalMs:             200,
+		AckSilenceMinutes:             15,
+		HeartbeatIntervalSeconds:      1,
+		PLCHeartbeatTimeoutSeconds:    10,
+		CommsLostAfterFailedPolls:     3,
+		CommsLostDisplayText:          "--:--",
 	}
 
-	f, err := os.Open(filePath)
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = json.NewDecoder(f).Decode(&conf); err != nil {
+	if err = json.Unmarshal(data, &conf); err != nil {
+		return nil, err
+	}
+
+	if len(conf.PLCs) == 0 {
+		conf.plcsFromTopLevel = true
+		conf.PLCs = []PLC{{
+			Name:                     DefaultPLC,
+			ModbusURL:                conf.ModbusURL,
+			ModbusClient:             conf.ModbusClient,
+			ModbusAddrLights:         conf.ModbusAddrLights,
+			ModbusAddrDisplays:       conf.ModbusAddrDisplays,
+			DisplaySlotBytes:         conf.DisplaySlotBytes,
+			ModbusAddrAckInputs:      conf.ModbusAddrAckInputs,
+			ModbusAddrHeartbeatOut:   conf.ModbusAddrHeartbeatOut,
+			ModbusAddrHeartbeatIn:    conf.ModbusAddrHeartbeatIn,
+			ModbusAddrCommsFaultCoil: conf.ModbusAddrCommsFaultCoil,
+		}}
+	}
+
+	for i := range conf.PLCs {
+		if conf.PLCs[i].DisplaySlotBytes == 0 {
+			conf.PLCs[i].DisplaySlotBytes = conf.DisplaySlotBytes
+		}
+
+		mc := &conf.PLCs[i].ModbusClient
+		if mc.Parity == "" {
+			mc.Parity = ParityNone
+		}
+		if mc.Endianness == "" {
+			mc.Endianness = LittleEndian
+		}
+		if mc.WordOrder == "" {
+			mc.WordOrder = HighWordFirst
+		}
+		if mc.OutputType == "" {
+			mc.OutputType = OutputCoil
+		}
+	}
+
+	if len(conf.OutputSinks) == 0 {
+		conf.OutputSinks = []OutputSink{{Type: SinkPLC}}
+	}
+
+	for i := range conf.HornQuietHours {
+		q := &conf.HornQuietHours[i]
+		q.start, q.end = minuteOfDay(q.Start), minuteOfDay(q.End)
+	}
+
+	if conf.MQTT.BrokerURL != "" && conf.MQTT.ClientID == "" {
+		conf.MQTT.ClientID = "spectromon-" + conf.MQTT.Site
+	}
+
+	for i := range conf.Furnaces {
+		f := &conf.Furnaces[i]
+		if f.PLC == "" {
+			f.PLC = conf.PLCs[0].Name
+		}
+
+		if f.AlarmAgeMinutes == 0 {
+			f.AlarmAgeMinutes = conf.FurnaceResultOldTimeMinutes
+		}
+
+		if len(f.DisplayPages) == 0 {
+			f.DisplayPages = []string{DisplayPageTime}
+		}
+
+		// no amber phase if not specified
+		if f.WarningAgeMinutes == 0 {
+			f.WarningAgeMinutes = f.AlarmAgeMinutes
+		}
+	}
+
+	errs := UnknownKeys(data, &conf)
+	if err = conf.Validate(); err != nil {
+		errs = append(errs, err.(ValidationError)...)
+	}
+	if err = errs.err(); err != nil {
 		return nil, err
 	}
 
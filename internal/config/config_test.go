@@ -0,0 +1,77 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHornEscalationPattern(t *testing.T) {
+	h := HornEscalation{PulseMs: []int{500, 250, 1000}}
+
+	if got, want := h.PatternLen(), 1750*time.Millisecond; got != want {
+		t.Errorf("PatternLen() = %s, want %s", got, want)
+	}
+	if got := (&HornEscalation{}).PatternLen(); got != 0 {
+		t.Errorf("PatternLen() of no pulses = %s, want 0", got)
+	}
+
+	tests := []struct {
+		d    time.Duration
+		want bool
+	}{
+		{0, true},
+		{499 * time.Millisecond, true},
+		{500 * time.Millisecond, false},
+		{749 * time.Millisecond, false},
+		{750 * time.Millisecond, true},
+		{1749 * time.Millisecond, true},
+		{1750 * time.Millisecond, false},
+		{time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		if got := h.PatternOn(tt.d); got != tt.want {
+			t.Errorf("PatternOn(%s) = %t, want %t", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2024, time.January, 5, hour, min, 30, 0, time.Local)
+	}
+	quiet := func(start, end string) *QuietHours {
+		return &QuietHours{Start: start, End: end, start: minuteOfDay(start), end: minuteOfDay(end)}
+	}
+
+	day := quiet("12:00", "13:30")
+	night := quiet("22:00", "06:00")
+	invalid := quiet("22:00", "6am")
+
+	tests := []struct {
+		name string
+		q    *QuietHours
+		t    time.Time
+		want bool
+	}{
+		{"before", day, at(11, 59), false},
+		{"start", day, at(12, 0), true},
+		{"during", day, at(13, 29), true},
+		{"end", day, at(13, 30), false},
+
+		{"evening before", night, at(21, 59), false},
+		{"night start", night, at(22, 0), true},
+		{"midnight", night, at(0, 0), true},
+		{"morning", night, at(5, 59), true},
+		{"night end", night, at(6, 0), false},
+		{"midday", night, at(12, 0), false},
+
+		{"invalid", invalid, at(23, 0), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.q.Contains(tt.t); got != tt.want {
+			t.Errorf("%s: %s-%s Contains(%s) = %t, want %t", tt.name, tt.q.Start, tt.q.End, tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+}
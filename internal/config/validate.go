@@ -0,0 +1,743 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/display"
+)
+
+// FieldError is a problem with the config value at a JSON path, e.g. furnaces[1].name
+type FieldError struct {
+	Path string
+	Msg  string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Msg
+}
+
+// ValidationError lists every problem found in a config.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d problems:", len(e))
+	for _, fe := range e {
+		sb.WriteString("\n\t")
+		sb.WriteString(fe.Error())
+	}
+	return sb.String()
+}
+
+func (e *ValidationError) add(path, format string, a ...any) {
+	*e = append(*e, FieldError{Path: path, Msg: fmt.Sprintf(format, a...)})
+}
+
+// nil if no problems
+func (e ValidationError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// UnknownKeys reports keys in JSON data that do not match a field of v,
+// which catches typos that would otherwise be silently ignored.
+func UnknownKeys(data []byte, v any) ValidationError {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil // reported by decode
+	}
+
+	var errs ValidationError
+	unknownKeys(&errs, "", raw, reflect.TypeOf(v))
+	return errs
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func unknownKeys(errs *ValidationError, path string, raw any, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]any)
+		if !ok || t == timeType {
+			return
+		}
+
+		fields := make(map[string]reflect.Type, t.NumField())
+		jsonFields(fields, t)
+
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+
+			// encoding/json matches keys case insensitively
+			ft, ok := fields[strings.ToLower(k)]
+			if !ok {
+				errs.add(p, "unknown key")
+				continue
+			}
+			unknownKeys(errs, p, obj[k], ft)
+		}
+
+	case reflect.Map:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return
+		}
+
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			unknownKeys(errs, path+"."+k, obj[k], t.Elem())
+		}
+
+	case reflect.Slice, reflect.Array:
+		arr, ok := raw.([]any)
+		if !ok {
+			return
+		}
+		for i, v := range arr {
+			unknownKeys(errs, fmt.Sprintf("%s[%d]", path, i), v, t.Elem())
+		}
+	}
+}
+
+// keys of struct t, including those of embedded structs
+func jsonFields(fields map[string]reflect.Type, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			jsonFields(fields, sf.Type)
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields[strings.ToLower(name)] = sf.Type
+	}
+}
+
+// Validate reports every problem with config values, with their JSON path.
+func (c *Config) Validate() error {
+	var errs ValidationError
+
+	if c.ResultUrl == "" {
+		errs.add("result_url", "required")
+	}
+
+	positive := func(path string, v int) {
+		if v <= 0 {
+			errs.add(path, "must be greater than 0, got %d", v)
+		}
+	}
+	notNegative := func(path string, v int) {
+		if v < 0 {
+			errs.add(path, "must not be negative, got %d", v)
+		}
+	}
+
+	positive("request_interval_seconds", c.RequestIntervalSeconds)
+	positive("display_board_update_rate_seconds", c.DisplayBoardUpdateRateSeconds)
+	positive("display_page_seconds", c.DisplayPageSeconds)
+	positive("display_slot_bytes", c.DisplaySlotBytes)
+	positive("light_flash_interval_ms", c.LightFlashIntervalMs)
+	notNegative("time_update_interval_seconds", c.TimeUpdateIntervalSeconds) // 0 disables
+	notNegative("furnace_result_old_time_minutes", c.FurnaceResultOldTimeMinutes)
+	notNegative("modbus_verify_retries", c.ModbusVerifyRetries)
+	notNegative("comms_lost_after_failed_polls", c.CommsLostAfterFailedPolls) // 0 disables
+
+	var ack, heartbeat, plcHeartbeat bool
+	for i := range c.PLCs {
+		p := &c.PLCs[i]
+		ack = ack || p.ModbusAddrAckInputs != nil
+		heartbeat = heartbeat || p.ModbusAddrHeartbeatOut != nil || p.ModbusAddrHeartbeatIn != nil
+		plcHeartbeat = plcHeartbeat || p.ModbusAddrHeartbeatIn != nil
+	}
+
+	if ack {
+		positive("ack_poll_interval_ms", c.AckPollIntervalMs)
+		notNegative("ack_silence_minutes", c.AckSilenceMinutes)
+		if c.AckInputType != AckDiscreteInput && c.AckInputType != AckHoldingRegister {
+			errs.add("ack_input_type", "must be %q or %q, got %q", AckDiscreteInput, AckHoldingRegister, c.AckInputType)
+		}
+	}
+
+	if heartbeat {
+		positive("heartbeat_interval_seconds", c.HeartbeatIntervalSeconds)
+	}
+	if plcHeartbeat {
+		positive("plc_heartbeat_timeout_seconds", c.PLCHeartbeatTimeoutSeconds)
+	}
+
+	switch c.TimeSyncSource {
+	case TimeSyncHTTP, TimeSyncNone:
+	case TimeSyncSNTP:
+		if c.SNTPServer == "" {
+			errs.add("sntp_server", "required for time_sync_source %q", TimeSyncSNTP)
+		}
+	default:
+		errs.add("time_sync_source", "must be %q, %q or %q, got %q", TimeSyncHTTP, TimeSyncSNTP, TimeSyncNone, c.TimeSyncSource)
+	}
+
+	if c.TimeSyncMode != TimeSyncSetClock && c.TimeSyncMode != TimeSyncOffsetOnly {
+		errs.add("time_sync_mode", "must be %q or %q, got %q", TimeSyncSetClock, TimeSyncOffsetOnly, c.TimeSyncMode)
+	} else if c.TimeSyncMode == TimeSyncOffsetOnly && c.TimeSyncSource != TimeSyncNone && !c.CompensateClockSkew {
+		// offset is only ever applied to sample ages
+		errs.add("time_sync_mode", "%q requires compensate_clock_skew", TimeSyncOffsetOnly)
+	}
+
+	if c.ModbusServerURL != "" && !strings.HasPrefix(c.ModbusServerURL, "tcp://") {
+		errs.add("modbus_server_url", "must be tcp://host:port, got %q", c.ModbusServerURL)
+	}
+
+	c.validatePLCs(&errs)
+	c.validateFurnaces(&errs)
+	c.validateMQTT(&errs)
+	c.validateOutputSinks(&errs)
+	c.validateHorns(&errs)
+
+	return errs.err()
+}
+
+func (c *Config) validatePLCs(errs *ValidationError) {
+	if !c.plcsFromTopLevel && c.ModbusURL != "" {
+		errs.add("modbus_url", "not used with plcs, set modbus_url of each PLC instead")
+	}
+	if !c.plcsFromTopLevel && c.ModbusClient != (ModbusClient{}) {
+		errs.add("plcs", "top level modbus client settings are not used with plcs, set them on each PLC instead")
+	}
+
+	names := make(map[string]int)
+	for i := range c.PLCs {
+		p := &c.PLCs[i]
+		path := c.plcPath(i)
+
+		if p.ModbusURL == "" {
+			errs.add(path+"modbus_url", "required")
+		} else if scheme, _, _ := strings.Cut(p.ModbusURL, "://"); !slices.Contains(modbusSchemes, scheme) {
+			errs.add(path+"modbus_url", "unsupported scheme %q, must be one of %q", scheme, modbusSchemes)
+		}
+
+		c.validateModbusClient(errs, path, &p.ModbusClient)
+		validateTLSFiles(errs, path, p)
+
+		// top level is checked on its own
+		if !c.plcsFromTopLevel && p.DisplaySlotBytes <= 0 {
+			errs.add(path+"display_slot_bytes", "must be greater than 0, got %d", p.DisplaySlotBytes)
+		}
+
+		if p.Name == "" {
+			errs.add(path+"name", "required")
+		} else if j, ok := names[p.Name]; ok {
+			errs.add(path+"name", "duplicate PLC name %q, also plcs[%d]", p.Name, j)
+		} else {
+			names[p.Name] = i
+		}
+
+		c.validateModbusRanges(errs, path, p)
+	}
+}
+
+// modbus client modes in modbus_url
+var modbusSchemes = []string{"tcp", "tcp+tls", "rtu", "rtuovertcp", "rtuoverudp", "udp"}
+
+func (c *Config) validateModbusClient(errs *ValidationError, path string, mc *ModbusClient) {
+	oneOf := func(key, v string, valid ...string) {
+		if !slices.Contains(valid, v) {
+			errs.add(path+key, "must be one of %q, got %q", valid, v)
+		}
+	}
+
+	oneOf("parity", mc.Parity, ParityNone, ParityEven, ParityOdd)
+	oneOf("endianness", mc.Endianness, LittleEndian, BigEndian)
+	oneOf("word_order", mc.WordOrder, HighWordFirst, LowWordFirst)
+	oneOf("output_type", mc.OutputType, OutputCoil, OutputHoldingRegister)
+
+	if mc.DataBits != 0 && (mc.DataBits < 5 || mc.DataBits > 8) {
+		errs.add(path+"data_bits", "must be 5-8, got %d", mc.DataBits)
+	}
+	if mc.StopBits > 2 {
+		errs.add(path+"stop_bits", "must be 1 or 2, got %d", mc.StopBits)
+	}
+	if mc.TimeoutMs < 0 {
+		errs.add(path+"timeout_ms", "must not be negative, got %d", mc.TimeoutMs)
+	}
+}
+
+// check TLS files are set only for tcp+tls:// and can be loaded
+func validateTLSFiles(errs *ValidationError, path string, p *PLC) {
+	files := []struct{ key, file string }{
+		{"tls_cert_file", p.TLSCertFile},
+		{"tls_key_file", p.TLSKeyFile},
+		{"tls_ca_file", p.TLSCAFile},
+	}
+
+	if !strings.HasPrefix(p.ModbusURL, "tcp+tls://") {
+		for _, f := range files {
+			if f.file != "" {
+				errs.add(path+f.key, "only used with tcp+tls:// modbus_url")
+			}
+		}
+		return
+	}
+
+	for _, f := range files {
+		if f.file == "" {
+			errs.add(path+f.key, "required for tcp+tls:// modbus_url")
+		}
+	}
+
+	if p.TLSCertFile != "" && p.TLSKeyFile != "" {
+		if _, err := tls.LoadX509KeyPair(p.TLSCertFile, p.TLSKeyFile); err != nil {
+			errs.add(path+"tls_cert_file", "%v", err)
+		}
+	}
+
+	if p.TLSCAFile != "" {
+		if pem, err := os.ReadFile(p.TLSCAFile); err != nil {
+			errs.add(path+"tls_ca_file", "%v", err)
+		} else if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			errs.add(path+"tls_ca_file", "no PEM certificates in %s", p.TLSCAFile)
+		}
+	}
+}
+
+func (c *Config) validateOutputSinks(errs *ValidationError) {
+	types := make(map[string]int)
+	for i := range c.OutputSinks {
+		s := &c.OutputSinks[i]
+		path := fmt.Sprintf("output_sinks[%d].", i)
+
+		switch s.Type {
+		case SinkPLC, SinkLog:
+			if j, ok := types[s.Type]; ok {
+				errs.add(path+"type", "duplicate %q sink, also output_sinks[%d]", s.Type, j)
+			}
+			types[s.Type] = i
+
+			if s.URL != "" {
+				errs.add(path+"url", "only used with %q sink", SinkWebhook)
+			}
+			if s.TimeoutMs != 0 {
+				errs.add(path+"timeout_ms", "only used with %q sink", SinkWebhook)
+			}
+
+		case SinkWebhook:
+			if !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+				errs.add(path+"url", "must be http:// or https:// URL, got %q", s.URL)
+			}
+			if s.TimeoutMs < 0 {
+				errs.add(path+"timeout_ms", "must not be negative, got %d", s.TimeoutMs)
+			}
+
+		default:
+			errs.add(path+"type", "must be %q, %q or %q, got %q", SinkPLC, SinkLog, SinkWebhook, s.Type)
+		}
+	}
+}
+
+// MQTT client modes in broker_url
+var (
+	mqttSchemes    = []string{"tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss"}
+	mqttTLSSchemes = []string{"ssl", "tls", "mqtts", "wss"}
+)
+
+func (c *Config) validateMQTT(errs *ValidationError) {
+	m := &c.MQTT
+	if m.BrokerURL == "" {
+		if *m != (MQTT{}) {
+			errs.add("mqtt.broker_url", "required with other mqtt settings")
+		}
+		return
+	}
+
+	scheme, _, _ := strings.Cut(m.BrokerURL, "://")
+	if !slices.Contains(mqttSchemes, scheme) {
+		errs.add("mqtt.broker_url", "unsupported scheme %q, must be one of %q", scheme, mqttSchemes)
+	}
+
+	// used as topic levels
+	validTopicLevel := func(path, s string) {
+		if strings.ContainsAny(s, "/+#") {
+			errs.add(path, "%q must not contain '/', '+' or '#' as it is used in MQTT topics", s)
+		}
+	}
+
+	if m.Site == "" {
+		errs.add("mqtt.site", "required")
+	}
+	validTopicLevel("mqtt.site", m.Site)
+	for i := range c.Furnaces {
+		validTopicLevel(fmt.Sprintf("furnaces[%d].name", i), c.Furnaces[i].Name)
+	}
+
+	if !slices.Contains(mqttTLSSchemes, scheme) {
+		for _, f := range []struct{ key, file string }{
+			{"tls_cert_file", m.TLSCertFile},
+			{"tls_key_file", m.TLSKeyFile},
+			{"tls_ca_file", m.TLSCAFile},
+		} {
+			if f.file != "" {
+				errs.add("mqtt."+f.key, "only used with %q broker_url", mqttTLSSchemes)
+			}
+		}
+		return
+	}
+
+	if (m.TLSCertFile == "") != (m.TLSKeyFile == "") {
+		errs.add("mqtt.tls_key_file", "tls_cert_file and tls_key_file must be set together")
+	} else if m.TLSCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(m.TLSCertFile, m.TLSKeyFile); err != nil {
+			errs.add("mqtt.tls_cert_file", "%v", err)
+		}
+	}
+
+	if m.TLSCAFile != "" {
+		if pem, err := os.ReadFile(m.TLSCAFile); err != nil {
+			errs.add("mqtt.tls_ca_file", "%v", err)
+		} else if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			errs.add("mqtt.tls_ca_file", "no PEM certificates in %s", m.TLSCAFile)
+		}
+	}
+}
+
+// JSON path prefix of PLC's keys
+func (c *Config) plcPath(i int) string {
+	if c.plcsFromTopLevel {
+		return ""
+	}
+	return fmt.Sprintf("plcs[%d].", i)
+}
+
+func (c *Config) validateFurnaces(errs *ValidationError) {
+	if len(c.Furnaces) == 0 {
+		errs.add("furnaces", "no furnaces configured")
+	}
+
+	plcs := make(map[string]bool)
+	for i := range c.PLCs {
+		plcs[c.PLCs[i].Name] = true
+	}
+
+	names := make(map[string]int)
+	boards := make(map[string]map[uint8]int) // per PLC
+
+	for i := range c.Furnaces {
+		f := &c.Furnaces[i]
+		path := fmt.Sprintf("furnaces[%d]", i)
+
+		if !plcs[f.PLC] {
+			errs.add(path+".plc", "unknown PLC %q", f.PLC)
+		}
+
+		if f.Name == "" {
+			errs.add(path+".name", "required")
+		} else if j, ok := names[f.Name]; ok {
+			errs.add(path+".name", "duplicate furnace name %q, also furnaces[%d]", f.Name, j)
+		} else {
+			names[f.Name] = i
+		}
+
+		if boards[f.PLC] == nil {
+			boards[f.PLC] = make(map[uint8]int)
+		}
+		if j, ok := boards[f.PLC][f.DisplayBoardAddress]; ok {
+			errs.add(path+".display_board_address", "duplicate display board address %d on PLC %q, also furnaces[%d]", f.DisplayBoardAddress, f.PLC, j)
+		} else {
+			boards[f.PLC][f.DisplayBoardAddress] = i
+		}
+
+		if f.WarningAgeMinutes < 0 {
+			errs.add(path+".warning_age_minutes", "must not be negative, got %d", f.WarningAgeMinutes)
+		} else if f.WarningAgeMinutes > f.AlarmAgeMinutes {
+			errs.add(path+".warning_age_minutes", "must not exceed alarm_age_minutes (%d), got %d", f.AlarmAgeMinutes, f.WarningAgeMinutes)
+		}
+		if f.AlarmAgeMinutes <= 0 {
+			errs.add(path+".alarm_age_minutes", "must be greater than 0, got %d", f.AlarmAgeMinutes)
+		}
+		if f.AlarmFlashAfterMinutes < 0 {
+			errs.add(path+".alarm_flash_after_minutes", "must not be negative, got %d", f.AlarmFlashAfterMinutes)
+		}
+
+		c.validateDisplay(errs, path, f)
+		validateStateOutputs(errs, path, f)
+
+		for j := range f.Downtime {
+			d := &f.Downtime[j]
+			dPath := fmt.Sprintf("%s.downtime[%d]", path, j)
+
+			if d.Start.IsZero() {
+				errs.add(dPath+".start", "required")
+			}
+			if !d.End.After(d.Start) {
+				errs.add(dPath+".end", "must be after start")
+			}
+			if d.RepeatWeekly && d.End.Sub(d.Start) >= 7*24*time.Hour {
+				errs.add(dPath+".end", "weekly window must be shorter than a week")
+			}
+		}
+	}
+}
+
+func validateStateOutputs(errs *ValidationError, path string, f *Furnace) {
+	states := make([]string, 0, len(f.StateOutputs))
+	for state := range f.StateOutputs {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	for _, state := range states {
+		out := f.StateOutputs[state]
+		sPath := path + ".state_outputs." + state
+
+		if !slices.Contains(FurnaceStates, state) {
+			errs.add(sPath, "unknown state, must be one of %q", FurnaceStates)
+		}
+		if out.HornPulseMs < 0 {
+			errs.add(sPath+".horn_pulse_ms", "must not be negative, got %d", out.HornPulseMs)
+		} else if out.HornPulseMs > 0 && f.HornCoil == nil {
+			errs.add(sPath+".horn_pulse_ms", "requires horn_coil of furnace")
+		}
+	}
+}
+
+func (c *Config) validateHorns(errs *ValidationError) {
+	h := &c.HornEscalation
+	if len(h.PulseMs) > 0 {
+		if h.AfterMinutes < 0 {
+			errs.add("horn_escalation.after_minutes", "must not be negative, got %d", h.AfterMinutes)
+		}
+		for i, ms := range h.PulseMs {
+			if ms <= 0 {
+				errs.add(fmt.Sprintf("horn_escalation.pulse_ms[%d]", i), "must be greater than 0, got %d", ms)
+			}
+		}
+		if h.RepeatMinutes < 0 {
+			errs.add("horn_escalation.repeat_minutes", "must not be negative, got %d", h.RepeatMinutes)
+		} else if h.RepeatMinutes > 0 && h.PatternLen() >= h.Repeat() {
+			errs.add("horn_escalation.repeat_minutes", "pulse pattern of %s does not fit in %d minutes", h.PatternLen(), h.RepeatMinutes)
+		}
+	} else if h.AfterMinutes != 0 || h.RepeatMinutes != 0 {
+		errs.add("horn_escalation.pulse_ms", "required with other horn_escalation settings")
+	}
+
+	for i := range c.HornQuietHours {
+		q := &c.HornQuietHours[i]
+		path := fmt.Sprintf("horn_quiet_hours[%d]", i)
+
+		if q.start < 0 {
+			errs.add(path+".start", "must be HH:MM, got %q", q.Start)
+		}
+		if q.end < 0 {
+			errs.add(path+".end", "must be HH:MM, got %q", q.End)
+		}
+		if q.start >= 0 && q.start == q.end {
+			errs.add(path+".end", "must differ from start")
+		}
+	}
+
+	horns := false
+	for i := range c.Furnaces {
+		f := &c.Furnaces[i]
+		if f.HornCoil == nil {
+			continue
+		}
+		horns = true
+
+		pulses := slices.ContainsFunc(FurnaceStates, func(s string) bool { return f.StateOutputs[s].HornPulseMs > 0 })
+		if !pulses && len(h.PulseMs) == 0 {
+			errs.add(fmt.Sprintf("furnaces[%d].horn_coil", i), "not used without horn_pulse_ms in state_outputs or horn_escalation")
+		}
+	}
+
+	if !horns && len(h.PulseMs) > 0 {
+		errs.add("horn_escalation", "no furnace has a horn_coil")
+	}
+}
+
+// check display pages and fixed texts fit in furnace's display slot
+func (c *Config) validateDisplay(errs *ValidationError, path string, f *Furnace) {
+	p, err := display.New(f.DisplayProtocol)
+	if err != nil {
+		errs.add(path+".display_protocol", "%v", err)
+		return
+	}
+
+	plc := c.PLCIndex(f.PLC)
+	if plc < 0 || c.PLCs[plc].DisplaySlotBytes <= 0 {
+		return // reported
+	}
+	slotBytes := c.PLCs[plc].DisplaySlotBytes
+
+	// frame plus nonce byte must fit in slot
+	maxLen := slotBytes - p.FrameLen(0) - 1
+	if maxLen < len("00:00") {
+		errs.add(c.plcPath(plc)+"display_slot_bytes", "%d bytes too small for time on display of %s, frame of %T display protocol needs %d bytes",
+			slotBytes, path, p, p.FrameLen(len("00:00"))+1)
+		return
+	}
+
+	fits := func(keyPath string, n int) {
+		if n > maxLen {
+			errs.add(keyPath, "%d bytes overflow %d byte display slot of %s, max %d bytes", n, slotBytes, path, maxLen)
+		}
+	}
+
+	fits("downtime_display_text", len(c.DowntimeDisplayText))
+	fits("comms_lost_display_text", len(c.CommsLostDisplayText))
+
+	for j, page := range f.DisplayPages {
+		pPath := fmt.Sprintf("%s.display_pages[%d]", path, j)
+
+		switch page {
+		case DisplayPageTime, DisplayPageSample:
+		case DisplayPageElement:
+			if f.DisplayElement == "" {
+				errs.add(path+".display_element", "required for %q display page", DisplayPageElement)
+			} else {
+				// e.g. "C 0.12"
+				fits(path+".display_element", len(f.DisplayElement)+len(" 0.00"))
+			}
+		default:
+			errs.add(pPath, "must be %q, %q or %q, got %q", DisplayPageTime, DisplayPageSample, DisplayPageElement, page)
+		}
+	}
+}
+
+// span of coils or registers used for one purpose
+type modbusRange struct {
+	path  string
+	start int
+	n     int
+}
+
+// check coil and holding register ranges on PLC do not overlap or overflow
+func (c *Config) validateModbusRanges(errs *ValidationError, path string, p *PLC) {
+	furnaces := c.FurnacesOn(p.Name)
+	n := len(furnaces)
+
+	// state outputs and horns can be shared by furnaces, e.g. one beacon or horn for all
+	stateOutputs := make(map[uint16]string) // JSON path of first use
+	horns := make(map[uint16]string)
+	var stateAddrs, hornAddrs []uint16
+	use := func(paths map[uint16]string, addrs *[]uint16, p string, addr uint16) {
+		if _, ok := paths[addr]; !ok {
+			paths[addr] = p
+			*addrs = append(*addrs, addr)
+		}
+	}
+
+	blockFurnaces := 0
+	for _, i := range furnaces {
+		f := &c.Furnaces[i]
+		if f.HornCoil != nil {
+			use(horns, &hornAddrs, fmt.Sprintf("furnaces[%d].horn_coil", i), *f.HornCoil)
+		}
+
+		if len(f.StateOutputs) == 0 {
+			blockFurnaces++
+			continue
+		}
+
+		for _, state := range FurnaceStates {
+			out := f.StateOutputs[state]
+			for j, addr := range out.On {
+				use(stateOutputs, &stateAddrs, fmt.Sprintf("furnaces[%d].state_outputs.%s.on[%d]", i, state, j), addr)
+			}
+			for j, addr := range out.Flash {
+				use(stateOutputs, &stateAddrs, fmt.Sprintf("furnaces[%d].state_outputs.%s.flash[%d]", i, state, j), addr)
+			}
+		}
+	}
+
+	outputs := []modbusRange{
+		{path + "modbus_address_start_lights", int(p.ModbusAddrLights), blockFurnaces * 3}, // red, green, amber
+	}
+	if p.ModbusAddrCommsFaultCoil != nil {
+		outputs = append(outputs, modbusRange{path + "modbus_address_comms_fault_coil", int(*p.ModbusAddrCommsFaultCoil), 1})
+	}
+	for _, addr := range stateAddrs {
+		outputs = append(outputs, modbusRange{stateOutputs[addr], int(addr), 1})
+	}
+	for _, addr := range hornAddrs {
+		outputs = append(outputs, modbusRange{horns[addr], int(addr), 1})
+	}
+
+	var coils []modbusRange
+	registers := []modbusRange{
+		{path + "modbus_address_start_displays", int(p.ModbusAddrDisplays), (n*p.DisplaySlotBytes + 1) / 2},
+	}
+
+	if p.OutputType == OutputHoldingRegister {
+		registers = append(registers, outputs...)
+	} else {
+		coils = outputs
+	}
+
+	if p.ModbusAddrHeartbeatOut != nil {
+		registers = append(registers, modbusRange{path + "modbus_address_heartbeat_out", int(*p.ModbusAddrHeartbeatOut), 1})
+	}
+	if p.ModbusAddrHeartbeatIn != nil {
+		registers = append(registers, modbusRange{path + "modbus_address_heartbeat_in", int(*p.ModbusAddrHeartbeatIn), 1})
+	}
+	if p.ModbusAddrAckInputs != nil && c.AckInputType == AckHoldingRegister {
+		registers = append(registers, modbusRange{path + "modbus_address_start_ack_inputs", int(*p.ModbusAddrAckInputs), n})
+	}
+
+	checkModbusRanges(errs, "coil", coils)
+	checkModbusRanges(errs, "register", registers)
+}
+
+func checkModbusRanges(errs *ValidationError, kind string, ranges []modbusRange) {
+	for i, r := range ranges {
+		if r.n > 0 && r.start+r.n > 1<<16 {
+			errs.add(r.path, "%s range %d-%d exceeds address space", kind, r.start, r.start+r.n-1)
+		}
+
+		for _, o := range ranges[:i] {
+			if r.n > 0 && o.n > 0 && r.start < o.start+o.n && o.start < r.start+r.n {
+				errs.add(r.path, "%s range %d-%d overlaps %s range %d-%d",
+					kind, r.start, r.start+r.n-1, o.path, o.start, o.start+o.n-1)
+			}
+		}
+	}
+}
@@ -31,6 +31,10 @@ func New(ctx context.Context, dbURL string) (*DBs, error) {
 	return &DBs{dbpool, ctx}, nil
 }
 
+func (db *DBs) Stat() *pgxpool.Stat {
+	return db.dbp.Stat()
+}
+
 func (db *DBs) Close() error {
 	db.dbp.Close()
 	return nil
@@ -44,12 +48,15 @@ type dbTestSample struct {
 	SampleName     string
 }
 
-// add new samples
-func (db *DBs) ProcessResults(results []model.Result) error {
+// add new samples. returns number of samples added per spectro machine
+func (db *DBs) ProcessResults(results []model.Result) (map[int]int, error) {
 	ctx, cancel := context.WithTimeout(db.ctx, time.Second*5)
 	defer cancel()
 
+	var added map[int]int
+
 	err := pgx.BeginFunc(ctx, db.dbp, func(tx pgx.Tx) error {
+		added = make(map[int]int)
 
 		var lastResult dbTestSample
 		err := pgxscan.Get(ctx, tx, &lastResult,
@@ -103,11 +110,17 @@ func (db *DBs) ProcessResults(results []model.Result) error {
 			if err != nil {
 				return fmt.Errorf("failed to add new test sample results. Insert qry: %s. Error: %w", rQry.String(), err)
 			}
+
+			added[r.Spectro]++
 		}
 		return nil
 	})
 
-	return err
+	if err != nil {
+		return nil, err
+	}
+
+	return added, nil
 }
 
 type dbTestSampleWithMeasurements struct {
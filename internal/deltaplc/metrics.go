@@ -0,0 +1,26 @@
+package deltaplc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	modbusWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spectromon_modbus_writes_total",
+		Help: "Modbus writes to Delta PLC by PLC, kind (coils, registers) and result (success, failure, not_connected).",
+	}, []string{"plc", "kind", "result"})
+
+	modbusReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spectromon_modbus_reconnects_total",
+		Help: "Successful reconnects to Delta PLC after the connection was lost.",
+	}, []string{"plc"})
+)
+
+func (m *Modbus) countWrite(kind string, err error) {
+	if err != nil {
+		modbusWrites.WithLabelValues(m.name, kind, "failure").Inc()
+	} else {
+		modbusWrites.WithLabelValues(m.name, kind, "success").Inc()
+	}
+}
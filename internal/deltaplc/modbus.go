@@ -1,7 +1,15 @@
 package deltaplc
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/RoanBrand/SpectroMonitor/internal/log"
@@ -9,77 +17,388 @@ import (
 	"github.com/simonvetter/modbus"
 )
 
+var ErrNotConnected = errors.New("not connected to Delta PLC")
+
 type Modbus struct {
+	name   string // for logs and metrics
 	c      *modbus.ModbusClient
-	active bool
+	active atomic.Bool // read without lock, which is held during requests
+	closed bool        // do not reconnect
+	lock   sync.Mutex
+
+	// redial in background, so requests to a PLC that is down do not wait on dial timeout
+	dialing     bool
+	nextDial    time.Time
+	dialBackoff time.Duration
+	lastDialErr string // logged once, until connected
+
+	// read back and compare after writes
+	verify        bool
+	verifyRetries int
+	outOfSync     atomic.Bool
+}
+
+const maxDialBackoff = 30 * time.Second
+
+// Options of modbus client. Zero values suit a Delta PLC.
+type Options struct {
+	// serial line, rtu:// only. zero for modbus library defaults
+	BaudRate uint
+	DataBits uint
+	Parity   uint // modbus.PARITY_NONE, PARITY_EVEN or PARITY_ODD
+	StopBits uint
+
+	UnitID  uint8         // default 1
+	Timeout time.Duration // default 5s
+
+	// PEM files for tcp+tls:// only. Client cert and CA are required
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSCAFile   string // CAs or PLC's own certificate to verify PLC with
+
+	BigEndian    bool // byte order in registers. Delta is little endian
+	LowWordFirst bool // word order of 32 bit values. Delta is high word first
 }
 
-func New(modbusURL string) (*Modbus, error) {
-	c, err := modbus.NewClient(&modbus.ClientConfiguration{
-		URL:     modbusURL,
-		Timeout: 5 * time.Second,
-	})
+func New(name, modbusURL string, opts Options) (*Modbus, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	conf := &modbus.ClientConfiguration{
+		URL:      modbusURL,
+		Speed:    opts.BaudRate,
+		DataBits: opts.DataBits,
+		Parity:   opts.Parity,
+		StopBits: opts.StopBits,
+		Timeout:  opts.Timeout,
+	}
+
+	if opts.TLSCertFile != "" || opts.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCertFile, opts.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate of PLC %s: %w", name, err)
+		}
+		conf.TLSClientCert = &cert
+	}
+
+	if opts.TLSCAFile != "" {
+		cas, err := modbus.LoadCertPool(opts.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS CA file of PLC %s: %w", name, err)
+		}
+		conf.TLSRootCAs = cas
+	}
+
+	c, err := modbus.NewClient(conf)
 	if err != nil {
-		return nil, fmt.Errorf("invalid modbus config: %w", err)
+		return nil, fmt.Errorf("invalid modbus config of PLC %s: %w", name, err)
 	}
 
-	// delta PLC words
-	c.SetEncoding(modbus.LITTLE_ENDIAN, modbus.HIGH_WORD_FIRST)
+	endianness, wordOrder := modbus.LITTLE_ENDIAN, modbus.HIGH_WORD_FIRST
+	if opts.BigEndian {
+		endianness = modbus.BIG_ENDIAN
+	}
+	if opts.LowWordFirst {
+		wordOrder = modbus.LOW_WORD_FIRST
+	}
+	c.SetEncoding(endianness, wordOrder)
 
-	m := &Modbus{c: c}
+	if opts.UnitID != 0 {
+		c.SetUnitId(opts.UnitID)
+	}
+
+	m := &Modbus{name: name, c: c}
 
 	if err = m.c.Open(); err != nil {
-		log.Println("error dialing modbus to Delta PLC at", modbusURL)
+		m.lastDialErr = describeError(err).Error()
+		log.Printf("error dialing modbus to Delta PLC %s at %s: %s", name, modbusURL, m.lastDialErr)
 	} else {
-		m.active = true
+		m.active.Store(true)
 	}
 
 	return m, nil
 }
 
+// SetVerify enables reading back written coils and registers,
+// rewriting up to retries times on mismatch.
+func (m *Modbus) SetVerify(enabled bool, retries int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.verify = enabled
+	m.verifyRetries = retries
+}
+
+func (m *Modbus) Name() string {
+	return m.name
+}
+
+// Connected does not wait for a request in progress.
+func (m *Modbus) Connected() bool {
+	return m.active.Load()
+}
+
+// InSync is false if last verified write did not read back as written.
+// Does not wait for a request in progress.
+func (m *Modbus) InSync() bool {
+	return !m.outOfSync.Load()
+}
+
 func (m *Modbus) Close() error {
-	if m.active {
-		m.active = false
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.closed = true
+	if m.active.Load() {
+		m.active.Store(false)
 		return m.c.Close()
 	}
 	return nil
 }
 
 // do not return error if connection still broken
-func (m *Modbus) WriteBytes(addr uint16, data []byte) error {
-	if !m.active {
-		if err := m.c.Open(); err != nil {
-			return nil
+func (m *Modbus) WriteBytes(addr uint16, data []byte) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.connect() {
+		modbusWrites.WithLabelValues(m.name, "registers", "not_connected").Inc()
+		return nil
+	}
+	defer func() { m.countWrite("registers", err) }()
+
+	if !m.verify {
+		if err := m.c.WriteBytes(addr, data); err != nil {
+			return m.disconnect(err)
+		}
+		return nil
+	}
+
+	// client swaps bytes of data in place
+	sent := slices.Clone(data)
+
+	return m.writeAndVerify("registers", addr,
+		func() error {
+			return m.c.WriteBytes(addr, slices.Clone(sent))
+		},
+		func() (bool, error) {
+			got, err := m.c.ReadBytes(addr, uint16(len(sent)), modbus.HOLDING_REGISTER)
+			return bytes.Equal(got, sent), err
+		})
+}
+
+func (m *Modbus) WriteCoils(addr uint16, values []bool) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.connect() {
+		modbusWrites.WithLabelValues(m.name, "coils", "not_connected").Inc()
+		return nil
+	}
+	defer func() { m.countWrite("coils", err) }()
+
+	if !m.verify {
+		if err := m.c.WriteCoils(addr, values); err != nil {
+			return m.disconnect(err)
 		}
+		return nil
+	}
 
-		m.active = true
-		log.Println("reconnected to Delta PLC")
+	return m.writeAndVerify("coils", addr,
+		func() error {
+			return m.c.WriteCoils(addr, values)
+		},
+		func() (bool, error) {
+			got, err := m.c.ReadCoils(addr, uint16(len(values)))
+			return slices.Equal(got, values), err
+		})
+}
+
+// do not return error if connection still broken
+func (m *Modbus) WriteRegisters(addr uint16, values []uint16) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.connect() {
+		modbusWrites.WithLabelValues(m.name, "registers", "not_connected").Inc()
+		return nil
 	}
+	defer func() { m.countWrite("registers", err) }()
 
-	if err := m.c.WriteBytes(addr, data); err != nil {
-		m.c.Close()
-		m.active = false
-		return err
+	if !m.verify {
+		if err := m.c.WriteRegisters(addr, values); err != nil {
+			return m.disconnect(err)
+		}
+		return nil
+	}
+
+	return m.writeAndVerify("registers", addr,
+		func() error {
+			return m.c.WriteRegisters(addr, values)
+		},
+		func() (bool, error) {
+			got, err := m.c.ReadRegisters(addr, uint16(len(values)), modbus.HOLDING_REGISTER)
+			return slices.Equal(got, values), err
+		})
+}
+
+// do not return error if connection still broken
+func (m *Modbus) WriteRegister(addr uint16, value uint16) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.connect() {
+		modbusWrites.WithLabelValues(m.name, "registers", "not_connected").Inc()
+		return nil
+	}
+	defer func() { m.countWrite("registers", err) }()
+
+	if err := m.c.WriteRegister(addr, value); err != nil {
+		return m.disconnect(err)
 	}
 
 	return nil
 }
 
-func (m *Modbus) WriteCoils(addr uint16, values []bool) error {
-	if !m.active {
-		if err := m.c.Open(); err != nil {
+func (m *Modbus) writeAndVerify(what string, addr uint16, write func() error, readBack func() (bool, error)) error {
+	for try := 0; ; try++ {
+		if err := write(); err != nil {
+			return m.disconnect(err)
+		}
+
+		equal, err := readBack()
+		if err != nil {
+			return fmt.Errorf("failed to read back %s: %w", what, m.disconnect(err))
+		}
+
+		if equal {
+			if m.outOfSync.Swap(false) {
+				log.Printf("Delta PLC %s back in sync", m.name)
+			}
 			return nil
 		}
 
-		m.active = true
-		log.Println("reconnected to Delta PLC")
+		if try >= m.verifyRetries {
+			m.outOfSync.Store(true)
+			return fmt.Errorf("PLC %s out of sync: %s at address %d do not read back as written after %d retries", m.name, what, addr, try)
+		}
+
+		log.Printf("Delta PLC %s %s at address %d do not read back as written, retrying", m.name, what, addr)
 	}
+}
+
+// returns ErrNotConnected if connection still broken
+func (m *Modbus) ReadDiscreteInputs(addr, quantity uint16) ([]bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
-	if err := m.c.WriteCoils(addr, values); err != nil {
-		m.c.Close()
-		m.active = false
-		return err
+	if !m.connect() {
+		return nil, ErrNotConnected
 	}
 
-	return nil
+	values, err := m.c.ReadDiscreteInputs(addr, quantity)
+	if err != nil {
+		return nil, m.disconnect(err)
+	}
+
+	return values, nil
+}
+
+// returns ErrNotConnected if connection still broken
+func (m *Modbus) ReadHoldingRegisters(addr, quantity uint16) ([]uint16, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.connect() {
+		return nil, ErrNotConnected
+	}
+
+	values, err := m.c.ReadRegisters(addr, quantity, modbus.HOLDING_REGISTER)
+	if err != nil {
+		return nil, m.disconnect(err)
+	}
+
+	return values, nil
+}
+
+// start reconnect if needed. return false if connection still broken
+func (m *Modbus) connect() bool {
+	if m.active.Load() {
+		return true
+	}
+
+	if !m.closed && !m.dialing && !time.Now().Before(m.nextDial) {
+		m.dialing = true
+		go m.redial()
+	}
+	return false
+}
+
+func (m *Modbus) redial() {
+	err := m.c.Open()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.dialing = false
+	if m.closed {
+		if err == nil {
+			m.c.Close()
+		}
+		return
+	}
+
+	if err != nil {
+		// log each new reason once, as reconnect is retried
+		if msg := describeError(err).Error(); msg != m.lastDialErr {
+			log.Printf("failed to connect to Delta PLC %s: %s", m.name, msg)
+			m.lastDialErr = msg
+		}
+
+		if m.dialBackoff *= 2; m.dialBackoff == 0 {
+			m.dialBackoff = time.Second
+		} else if m.dialBackoff > maxDialBackoff {
+			m.dialBackoff = maxDialBackoff
+		}
+		m.nextDial = time.Now().Add(m.dialBackoff)
+		return
+	}
+
+	m.active.Store(true)
+	m.dialBackoff = 0
+	m.lastDialErr = ""
+	modbusReconnects.WithLabelValues(m.name).Inc()
+	log.Println("reconnected to Delta PLC", m.name)
+}
+
+// close broken connection. returns err, explained if TLS related
+func (m *Modbus) disconnect(err error) error {
+	m.c.Close()
+	m.active.Store(false)
+	return describeError(err)
+}
+
+// explain TLS handshake failures, which are not obvious from the error alone
+func describeError(err error) error {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var record tls.RecordHeaderError
+
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return fmt.Errorf("TLS handshake failed, PLC certificate not signed by a CA in tls_ca_file: %w", err)
+	case errors.As(err, &hostname):
+		return fmt.Errorf("TLS handshake failed, PLC certificate not valid for host in modbus_url: %w", err)
+	case errors.As(err, &invalid):
+		return fmt.Errorf("TLS handshake failed, PLC certificate invalid or expired: %w", err)
+	case errors.As(err, &record):
+		return fmt.Errorf("TLS handshake failed, PLC does not speak TLS on this port: %w", err)
+	case strings.Contains(err.Error(), "remote error: tls:"):
+		// alert from PLC, sent after handshake with TLS 1.3
+		return fmt.Errorf("TLS handshake failed, PLC rejected our client certificate: %w", err)
+	}
+
+	return err
 }
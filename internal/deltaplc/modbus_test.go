@@ -0,0 +1,200 @@
+package deltaplc
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/sim"
+)
+
+func newTLSPLC(t *testing.T) (*sim.PLC, *sim.PKI) {
+	t.Helper()
+
+	pki, err := sim.NewPKI(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plc, err := sim.NewTLSPLC(pki.ServerCert, pki.CAs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { plc.Close() })
+
+	return plc, pki
+}
+
+func newModbus(t *testing.T, url string, opts Options) *Modbus {
+	t.Helper()
+
+	opts.Timeout = 2 * time.Second
+	m, err := New("test", url, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+
+	return m
+}
+
+// error from dialing, or from first write as TLS 1.3 servers reject client certificates after handshake
+func connectErr(t *testing.T, m *Modbus) string {
+	t.Helper()
+
+	if m.Connected() {
+		err := m.WriteCoils(0, []bool{true})
+		if err == nil {
+			t.Fatal("write succeeded")
+		}
+		return err.Error()
+	}
+	return m.lastDialErr
+}
+
+func TestTLSWrite(t *testing.T) {
+	plc, pki := newTLSPLC(t)
+	m := newModbus(t, plc.URL, Options{
+		TLSCertFile: pki.ClientCertFile,
+		TLSKeyFile:  pki.ClientKeyFile,
+		TLSCAFile:   pki.CAFile,
+	})
+
+	if !m.Connected() {
+		t.Fatalf("not connected: %s", m.lastDialErr)
+	}
+
+	want := []bool{true, false, true}
+	if err := m.WriteCoils(3, want); err != nil {
+		t.Fatal(err)
+	}
+	if got := plc.Coils(3, 3); !slices.Equal(got, want) {
+		t.Errorf("got coils %v, want %v", got, want)
+	}
+}
+
+func TestTLSUnknownCA(t *testing.T) {
+	plc, pki := newTLSPLC(t)
+
+	other, err := sim.NewPKI(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newModbus(t, plc.URL, Options{
+		TLSCertFile: pki.ClientCertFile,
+		TLSKeyFile:  pki.ClientKeyFile,
+		TLSCAFile:   other.CAFile,
+	})
+
+	if m.Connected() {
+		t.Fatal("connected to PLC with certificate of unknown CA")
+	}
+	if want := "PLC certificate not signed by a CA in tls_ca_file"; !strings.Contains(m.lastDialErr, want) {
+		t.Errorf("got error %q, want it to contain %q", m.lastDialErr, want)
+	}
+
+	// write is dropped while not connected
+	if err = m.WriteCoils(0, []bool{true}); err != nil {
+		t.Error(err)
+	}
+	if plc.Coils(0, 1)[0] {
+		t.Error("coil written without connection")
+	}
+}
+
+func TestTLSMissingClientCert(t *testing.T) {
+	plc, pki := newTLSPLC(t)
+
+	_, err := New("test", plc.URL, Options{TLSCAFile: pki.CAFile})
+	if err == nil || !strings.Contains(err.Error(), "invalid modbus config of PLC test") {
+		t.Errorf("got error %v, want invalid modbus config", err)
+	}
+}
+
+func TestTLSClientCertRejected(t *testing.T) {
+	plc, pki := newTLSPLC(t)
+
+	// client certificate of a CA the PLC does not trust
+	other, err := sim.NewPKI(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newModbus(t, plc.URL, Options{
+		TLSCertFile: other.ClientCertFile,
+		TLSKeyFile:  other.ClientKeyFile,
+		TLSCAFile:   pki.CAFile,
+	})
+
+	if got, want := connectErr(t, m), "PLC rejected our client certificate"; !strings.Contains(got, want) {
+		t.Errorf("got error %q, want it to contain %q", got, want)
+	}
+	if plc.Coils(0, 1)[0] {
+		t.Error("coil written with rejected client certificate")
+	}
+}
+
+// requests to a PLC that is down do not wait on redialling it
+func TestRedialInBackground(t *testing.T) {
+	plc, pki := newTLSPLC(t)
+	m := newModbus(t, plc.URL, Options{
+		TLSCertFile: pki.ClientCertFile,
+		TLSKeyFile:  pki.ClientKeyFile,
+		TLSCAFile:   pki.CAFile,
+	})
+	if !m.Connected() {
+		t.Fatalf("not connected: %s", m.lastDialErr)
+	}
+
+	// in place of PLC, accept connections but never finish the TLS handshake
+	plc.Close()
+	l, err := net.Listen("tcp", strings.TrimPrefix(plc.URL, "tcp+tls://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			conns = append(conns, c)
+			lock.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		l.Close()
+		lock.Lock()
+		defer lock.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	})
+
+	if err = m.WriteCoils(0, []bool{true}); err == nil {
+		t.Fatal("write succeeded on closed connection")
+	}
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err = m.WriteCoils(0, []bool{true}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = m.ReadDiscreteInputs(0, 1); err != ErrNotConnected {
+			t.Fatalf("got error %v, want ErrNotConnected", err)
+		}
+		if m.Connected() {
+			t.Fatal("connected to PLC that does not answer")
+		}
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("requests took %s while PLC is down", d)
+	}
+}
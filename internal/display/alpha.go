@@ -0,0 +1,83 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+const (
+	nul = 0x00
+	soh = 0x01
+	stx = 0x02
+	etx = 0x03
+	eot = 0x04
+	esc = 0x1b
+
+	alphaSyncLen = 5 // NULs for sign to detect baud rate
+)
+
+// Alpha sign communications protocol (Alpha/EZ95 boards).
+// Writes msg to text file A, held static in the middle line:
+// NUL*5 SOH 'Z' addr(2 hex) STX 'A' 'A' ESC ' ' 'b' msg ETX checksum(4 hex) EOT
+type Alpha struct{}
+
+func (Alpha) Encode(dst []byte, address uint8, msg []byte) []byte {
+	for i := 0; i < alphaSyncLen; i++ {
+		dst = append(dst, nul)
+	}
+
+	dst = append(dst, soh, 'Z')
+	dst = append(dst, fmt.Sprintf("%02X", address)...)
+
+	sumStart := len(dst)
+	dst = append(dst, stx, 'A', 'A', esc, ' ', 'b')
+	dst = append(dst, msg...)
+	dst = append(dst, etx)
+
+	var sum uint16
+	for _, b := range dst[sumStart:] {
+		sum += uint16(b)
+	}
+
+	dst = append(dst, fmt.Sprintf("%04X", sum)...)
+	return append(dst, eot)
+}
+
+func (Alpha) Decode(frame []byte) (uint8, []byte, error) {
+	frame = bytes.TrimLeft(frame, "\x00")
+	if len(frame) < 16 || frame[0] != soh || frame[1] != 'Z' {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	address, err := strconv.ParseUint(string(frame[2:4]), 16, 8)
+	if err != nil {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	body := frame[4:]
+	if !bytes.HasPrefix(body, []byte{stx, 'A', 'A', esc, ' ', 'b'}) {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	end := bytes.IndexByte(body, etx)
+	if end < 0 || len(body) < end+6 || body[end+5] != eot {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	var sum uint16
+	for _, b := range body[:end+1] {
+		sum += uint16(b)
+	}
+
+	want, err := strconv.ParseUint(string(body[end+1:end+5]), 16, 16)
+	if err != nil || uint16(want) != sum {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	return uint8(address), body[6:end], nil
+}
+
+func (Alpha) FrameLen(msgLen int) int {
+	return msgLen + 21
+}
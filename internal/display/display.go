@@ -0,0 +1,38 @@
+// Package display frames text messages for serial display boards.
+package display
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidFrame = errors.New("invalid display frame")
+
+// Protocol encodes and decodes messages in a display board vendor's framing.
+type Protocol interface {
+	// Encode appends the frame of msg for board at address to dst.
+	Encode(dst []byte, address uint8, msg []byte) []byte
+
+	// Decode returns the board address and message of a frame.
+	Decode(frame []byte) (address uint8, msg []byte, err error)
+
+	// FrameLen returns the length of a frame for a message of msgLen bytes.
+	FrameLen(msgLen int) int
+}
+
+const (
+	ProtocolStandard = "standard"
+	ProtocolAlpha    = "alpha"
+)
+
+// New returns the Protocol by config name. Empty name is standard.
+func New(name string) (Protocol, error) {
+	switch name {
+	case "", ProtocolStandard:
+		return Standard{}, nil
+	case ProtocolAlpha:
+		return Alpha{}, nil
+	default:
+		return nil, fmt.Errorf("unknown display protocol '%s'", name)
+	}
+}
@@ -0,0 +1,97 @@
+package display
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var protocols = []string{ProtocolStandard, ProtocolAlpha}
+
+var messages = []string{"", "00:00", "12 34", "S-1234", "C 0.25"}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range protocols {
+		p, err := New(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, addr := range []uint8{0, 1, 3, 0x7F, 0xFF} {
+			for _, msg := range messages {
+				frame := p.Encode(nil, addr, []byte(msg))
+
+				if got := p.FrameLen(len(msg)); got != len(frame) {
+					t.Errorf("%s: FrameLen(%d) = %d, encoded frame is %d bytes", name, len(msg), got, len(frame))
+				}
+
+				gotAddr, gotMsg, err := p.Decode(frame)
+				if err != nil {
+					t.Errorf("%s: decode of address %d, %q: %v", name, addr, msg, err)
+					continue
+				}
+				if gotAddr != addr || string(gotMsg) != msg {
+					t.Errorf("%s: decoded address %d, %q, want %d, %q", name, gotAddr, gotMsg, addr, msg)
+				}
+			}
+		}
+	}
+}
+
+// frames are written into display slots after other bytes, with a nonce after them
+func TestEncodeAppends(t *testing.T) {
+	for _, name := range protocols {
+		p, _ := New(name)
+
+		prefix := []byte("slot")
+		frame := p.Encode(bytes.Clone(prefix), 2, []byte("00:15"))
+		if !bytes.HasPrefix(frame, prefix) {
+			t.Fatalf("%s: Encode overwrote dst", name)
+		}
+
+		_, msg, err := p.Decode(append(frame[len(prefix):], 7))
+		if err != nil || string(msg) != "00:15" {
+			t.Errorf("%s: decode of frame with trailing nonce = %q, %v", name, msg, err)
+		}
+	}
+}
+
+func TestDecodeCorruptChecksum(t *testing.T) {
+	for _, name := range protocols {
+		p, _ := New(name)
+		frame := p.Encode(nil, 1, []byte("00:10"))
+
+		// checksum is right before Alpha's EOT, and last in standard frames
+		i := len(frame) - 1
+		if name == ProtocolAlpha {
+			i--
+		}
+		frame[i]++
+
+		if _, _, err := p.Decode(frame); !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("%s: decode of corrupt checksum: got %v, want %v", name, err, ErrInvalidFrame)
+		}
+	}
+}
+
+func TestDecodeCorruptMessage(t *testing.T) {
+	for _, name := range protocols {
+		p, _ := New(name)
+		frame := p.Encode(nil, 1, []byte("00:10"))
+
+		frame[bytes.Index(frame, []byte("00:10"))]++
+
+		if _, _, err := p.Decode(frame); !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("%s: decode of corrupt message: got %v, want %v", name, err, ErrInvalidFrame)
+		}
+	}
+}
+
+func TestNewUnknown(t *testing.T) {
+	if _, err := New("ledsign"); err == nil {
+		t.Error("no error for unknown protocol")
+	}
+	if p, err := New(""); err != nil || p != (Standard{}) {
+		t.Errorf("empty protocol = %v, %v, want standard", p, err)
+	}
+}
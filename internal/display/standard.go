@@ -0,0 +1,48 @@
+package display
+
+import "bytes"
+
+// Standard framing of our original display boards:
+// 0x00 0x53 address 0x03 msg 0x04 xor
+type Standard struct{}
+
+func (Standard) Encode(dst []byte, address uint8, msg []byte) []byte {
+	start := len(dst)
+	dst = append(dst, 0x0, 0x53, address, 0x3)
+
+	dst = append(dst, msg...)
+	dst = append(dst, 0x4)
+
+	var newXor byte
+	for _, dataByte := range dst[start:] {
+		newXor ^= dataByte
+	}
+
+	return append(dst, newXor)
+}
+
+func (Standard) Decode(frame []byte) (uint8, []byte, error) {
+	if len(frame) < 6 || frame[0] != 0x0 || frame[1] != 0x53 || frame[3] != 0x3 {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	end := bytes.IndexByte(frame[4:], 0x4)
+	if end < 0 || 4+end+1 >= len(frame) {
+		return 0, nil, ErrInvalidFrame
+	}
+	end += 4
+
+	var xor byte
+	for _, dataByte := range frame[:end+1] {
+		xor ^= dataByte
+	}
+	if xor != frame[end+1] {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	return frame[2], frame[4:end], nil
+}
+
+func (Standard) FrameLen(msgLen int) int {
+	return msgLen + 6
+}
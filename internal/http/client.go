@@ -7,33 +7,38 @@ import (
 	"time"
 
 	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
 )
 
-type resultResponse struct {
-	SampleName string    `json:"sample_name"`
-	Furnace    string    `json:"furnace"`
-	TimeStamp  time.Time `json:"time_stamp"`
-}
+// GetResult also returns server's time from the Date header, if any.
+// A request taking longer than the request interval is abandoned,
+// so that a hung server counts as a failed poll.
+func GetResult(url string, conf *config.Config) ([]model.Result, time.Time, error) {
+	var serverTime time.Time
 
-func GetResult(url string, conf *config.Config) ([]resultResponse, error) {
-	resp, err := http.Get(url)
+	client := http.Client{Timeout: time.Duration(conf.RequestIntervalSeconds) * time.Second}
+	resp, err := client.Get(url)
 	if err != nil {
-		return nil, err
+		return nil, serverTime, err
 	}
 
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("request error: " + resp.Status)
+		return nil, serverTime, errors.New("request error: " + resp.Status)
 	}
 
-	defer resp.Body.Close()
-	res := make([]resultResponse, 0, len(conf.Furnaces))
+	res := make([]model.Result, 0, len(conf.Furnaces))
 
 	dec := json.NewDecoder(resp.Body)
 	if err := dec.Decode(&res); err != nil {
-		return nil, err
+		return nil, serverTime, err
 	}
 
-	return res, nil
+	if date := resp.Header.Get("Date"); date != "" {
+		serverTime, _ = http.ParseTime(date)
+	}
+
+	return res, serverTime, nil
 }
 
 func GetTime(url string) (time.Time, error) {
@@ -46,11 +51,11 @@ func GetTime(url string) (time.Time, error) {
 		return res.T, err
 	}
 
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return res.T, errors.New("gettime request error: " + resp.Status)
 	}
 
-	defer resp.Body.Close()
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	return res.T, err
 }
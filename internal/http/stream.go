@@ -0,0 +1,109 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
+)
+
+// SubscribeResults reads a Server-Sent Events stream of furnace results.
+// Each event's data is a result or an array of results.
+// onConnected is called once the stream is established.
+// Blocks until ctx is done or the stream drops.
+// Receiving nothing for idleTimeout, not even a keepalive comment,
+// counts as a drop, so a stalled connection is not mistaken for no new results.
+func SubscribeResults(ctx context.Context, url string, idleTimeout time.Duration, onConnected func(), onResults func([]model.Result)) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	idle := time.AfterFunc(idleTimeout, cancel)
+	defer idle.Stop()
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return idleErr(ctx, streamCtx, idleTimeout, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("result stream request error: " + resp.Status)
+	}
+
+	onConnected()
+
+	var data bytes.Buffer
+	s := bufio.NewScanner(resp.Body)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for s.Scan() {
+		idle.Reset(idleTimeout)
+		line := s.Text()
+
+		switch {
+		case line == "":
+			// dispatch event
+			if data.Len() == 0 {
+				continue
+			}
+
+			res, err := decodeResults(data.Bytes())
+			data.Reset()
+			if err != nil {
+				return err
+			}
+
+			onResults(res)
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// comments, event names, ids and retry are ignored
+	}
+
+	if err = s.Err(); err != nil {
+		return idleErr(ctx, streamCtx, idleTimeout, err)
+	}
+
+	return errors.New("result stream closed by server")
+}
+
+// replaces err from request cancelled by idle timer
+func idleErr(ctx, streamCtx context.Context, idleTimeout time.Duration, err error) error {
+	if ctx.Err() == nil && streamCtx.Err() != nil {
+		return fmt.Errorf("nothing received on result stream for %s", idleTimeout)
+	}
+	return err
+}
+
+func decodeResults(data []byte) ([]model.Result, error) {
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '[' {
+		var res []model.Result
+		err := json.Unmarshal(data, &res)
+		return res, err
+	}
+
+	var r model.Result
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return []model.Result{r}, nil
+}
@@ -0,0 +1,83 @@
+package samplecollector
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/db"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	samplesIngested = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "samplecollector_samples_ingested_total",
+		Help: "Test samples added to DB per spectro machine.",
+	}, []string{"spectro"})
+
+	processResultsDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "samplecollector_process_results_duration_seconds",
+		Help:    "Time taken to add new results to DB.",
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	})
+
+	processResultsErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "samplecollector_process_results_errors_total",
+		Help: "Failed attempts to add new results to DB.",
+	})
+
+	resultsCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "samplecollector_results_cache_requests_total",
+		Help: "Requests to /results by cache result (hit, miss).",
+	}, []string{"result"})
+)
+
+func observeProcessResults(start time.Time, added map[int]int, err error) {
+	processResultsDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		processResultsErrors.Inc()
+		return
+	}
+
+	for spectro, n := range added {
+		samplesIngested.WithLabelValues(strconv.Itoa(spectro)).Add(float64(n))
+	}
+}
+
+// pgxpool stats on scrape
+type dbPoolCollector struct {
+	dbs *db.DBs
+}
+
+var (
+	dbPoolAcquiredConns = prometheus.NewDesc("samplecollector_db_pool_acquired_conns", "Currently acquired DB connections.", nil, nil)
+	dbPoolIdleConns     = prometheus.NewDesc("samplecollector_db_pool_idle_conns", "Currently idle DB connections.", nil, nil)
+	dbPoolTotalConns    = prometheus.NewDesc("samplecollector_db_pool_total_conns", "Total DB connections in pool.", nil, nil)
+	dbPoolMaxConns      = prometheus.NewDesc("samplecollector_db_pool_max_conns", "Maximum size of DB pool.", nil, nil)
+	dbPoolAcquires      = prometheus.NewDesc("samplecollector_db_pool_acquires_total", "Successful DB connection acquires.", nil, nil)
+	dbPoolEmptyAcquires = prometheus.NewDesc("samplecollector_db_pool_empty_acquires_total", "Acquires that had to wait for a connection.", nil, nil)
+	dbPoolAcquireTime   = prometheus.NewDesc("samplecollector_db_pool_acquire_seconds_total", "Total time spent acquiring DB connections.", nil, nil)
+)
+
+func (c dbPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbPoolAcquiredConns
+	ch <- dbPoolIdleConns
+	ch <- dbPoolTotalConns
+	ch <- dbPoolMaxConns
+	ch <- dbPoolAcquires
+	ch <- dbPoolEmptyAcquires
+	ch <- dbPoolAcquireTime
+}
+
+func (c dbPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.dbs.Stat()
+
+	ch <- prometheus.MustNewConstMetric(dbPoolAcquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(dbPoolIdleConns, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(dbPoolTotalConns, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(dbPoolMaxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(dbPoolAcquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(dbPoolEmptyAcquires, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(dbPoolAcquireTime, prometheus.CounterValue, s.AcquireDuration().Seconds())
+}
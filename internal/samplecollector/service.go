@@ -19,6 +19,8 @@ import (
 	"github.com/RoanBrand/SpectroMonitor/internal/db"
 	"github.com/RoanBrand/SpectroMonitor/internal/model"
 	"github.com/kardianos/service"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type app struct {
@@ -67,6 +69,8 @@ func (a *app) startup() {
 		}
 	}
 
+	prometheus.MustRegister(dbPoolCollector{a.dbs})
+
 	a.doTask()
 	go a.doTaskPeriodically()
 
@@ -115,7 +119,10 @@ func (a *app) doTask() {
 		return
 	}
 
-	if err = a.dbs.ProcessResults(results); err != nil {
+	start := time.Now()
+	added, err := a.dbs.ProcessResults(results)
+	observeProcessResults(start, added, err)
+	if err != nil {
 		log.Println("failed inserting results into DB:", err)
 		return
 	}
@@ -144,6 +151,7 @@ func (a *app) getResults() ([]model.Result, error) {
 func (a *app) setupAndStartAPIServer(websiteFilesPath string) error {
 	http.Handle("/", http.FileServer(http.Dir(websiteFilesPath)))
 	http.HandleFunc("/results", a.resultEndpoint)
+	http.Handle("/metrics", promhttp.Handler())
 	a.api.Addr = ":" + strconv.Itoa(a.conf.HTTPServerPort)
 
 	err := a.api.ListenAndServe()
@@ -176,6 +184,7 @@ func (a *app) getAPIResultsCache() ([]byte, error) {
 	a.cacheLock.RLock()
 	if time.Now().Before(a.cacheExpires) {
 		defer a.cacheLock.RUnlock()
+		resultsCacheRequests.WithLabelValues("hit").Inc()
 		return a.cacheResult, nil
 	}
 
@@ -184,9 +193,12 @@ func (a *app) getAPIResultsCache() ([]byte, error) {
 	defer a.cacheLock.Unlock()
 
 	if time.Now().Before(a.cacheExpires) {
+		resultsCacheRequests.WithLabelValues("hit").Inc()
 		return a.cacheResult, nil
 	}
 
+	resultsCacheRequests.WithLabelValues("miss").Inc()
+
 	results, err := a.dbs.GetLatest20ResultsForTVs()
 	if err != nil {
 		return nil, err
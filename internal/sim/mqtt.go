@@ -0,0 +1,379 @@
+package sim
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Message records a single MQTT publish received by the broker,
+// or a client's last will published when it dropped without disconnecting.
+type Message struct {
+	Time     time.Time
+	ClientID string
+	Topic    string
+	Payload  []byte
+	Retained bool
+	Will     bool
+}
+
+// Broker is a minimal MQTT 3.1.1 broker that keeps retained messages and
+// records every publish. It does not forward messages to subscribers.
+type Broker struct {
+	URL string // for client to dial, e.g. tcp://127.0.0.1:1883
+
+	l net.Listener
+
+	lock     sync.Mutex
+	username string
+	password string
+	down     bool
+	conns    map[net.Conn]struct{}
+	retained map[string][]byte
+	messages []Message
+}
+
+// NewBroker starts a broker listening on a free local port.
+func NewBroker() (*Broker, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return newBroker("tcp://"+l.Addr().String(), l), nil
+}
+
+// NewTLSBroker starts a broker on a free local port, presenting serverCert
+// and requiring client certificates signed by clientCAs, if not nil.
+func NewTLSBroker(serverCert tls.Certificate, clientCAs *x509.CertPool) (*Broker, error) {
+	conf := &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	if clientCAs != nil {
+		conf.ClientCAs = clientCAs
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", conf)
+	if err != nil {
+		return nil, err
+	}
+	return newBroker("ssl://"+l.Addr().String(), l), nil
+}
+
+func newBroker(url string, l net.Listener) *Broker {
+	b := &Broker{
+		URL:      url,
+		l:        l,
+		conns:    make(map[net.Conn]struct{}),
+		retained: make(map[string][]byte),
+	}
+	go b.accept()
+	return b
+}
+
+func (b *Broker) Close() error {
+	err := b.l.Close()
+	b.SetDown(true)
+	return err
+}
+
+// SetCredentials makes the broker refuse clients without this username and password.
+func (b *Broker) SetCredentials(username, password string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.username, b.password = username, password
+}
+
+// SetDown drops all clients, without publishing their last will,
+// and refuses new connections while down.
+func (b *Broker) SetDown(down bool) {
+	b.lock.Lock()
+	b.down = down
+	b.lock.Unlock()
+
+	if down {
+		b.dropClients()
+	}
+}
+
+// DropClients closes all client connections while the broker stays up,
+// as if the network dropped. Their last wills are published.
+func (b *Broker) DropClients() {
+	b.dropClients()
+}
+
+// Messages returns all messages received so far.
+func (b *Broker) Messages() []Message {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]Message(nil), b.messages...)
+}
+
+// Retained returns the retained message on topic, if any.
+func (b *Broker) Retained(topic string) ([]byte, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	p, ok := b.retained[topic]
+	return p, ok
+}
+
+func (b *Broker) isDown() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.down
+}
+
+func (b *Broker) dropClients() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for c := range b.conns {
+		c.Close()
+	}
+}
+
+func (b *Broker) accept() {
+	for {
+		c, err := b.l.Accept()
+		if err != nil {
+			return
+		}
+
+		b.lock.Lock()
+		if b.down {
+			b.lock.Unlock()
+			c.Close()
+			continue
+		}
+		b.conns[c] = struct{}{}
+		b.lock.Unlock()
+
+		go b.serve(c)
+	}
+}
+
+// MQTT control packet types
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttPubAck     = 4
+	mqttSubscribe  = 8
+	mqttSubAck     = 9
+	mqttPingReq    = 12
+	mqttPingResp   = 13
+	mqttDisconnect = 14
+)
+
+// last will of a client
+type will struct {
+	topic    string
+	payload  []byte
+	retained bool
+}
+
+func (b *Broker) serve(c net.Conn) {
+	defer func() {
+		b.lock.Lock()
+		delete(b.conns, c)
+		b.lock.Unlock()
+		c.Close()
+	}()
+
+	r := bufio.NewReader(c)
+
+	header, body, err := readPacket(r)
+	if err != nil || header>>4 != mqttConnect {
+		return
+	}
+
+	clientID, w, ok := b.connect(body)
+	if !ok {
+		c.Write([]byte{mqttConnAck << 4, 2, 0, 4}) // bad username or password
+		return
+	}
+	if _, err = c.Write([]byte{mqttConnAck << 4, 2, 0, 0}); err != nil {
+		return
+	}
+
+	for {
+		header, body, err = readPacket(r)
+		if err != nil {
+			if w != nil && !b.isDown() {
+				b.publish(Message{ClientID: clientID, Topic: w.topic, Payload: w.payload, Retained: w.retained, Will: true})
+			}
+			return
+		}
+
+		switch header >> 4 {
+		case mqttPublish:
+			m, id, err := parsePublish(header, body)
+			if err != nil {
+				return
+			}
+			m.ClientID = clientID
+			b.publish(m)
+
+			if id != 0 {
+				c.Write([]byte{mqttPubAck << 4, 2, byte(id >> 8), byte(id)})
+			}
+
+		case mqttSubscribe:
+			// refuse every topic filter
+			if len(body) < 2 {
+				return
+			}
+			ack := []byte{mqttSubAck << 4, 0, body[0], body[1]}
+			for rest := body[2:]; len(rest) > 0; {
+				if _, rest, err = readString(rest); err != nil || len(rest) == 0 {
+					return
+				}
+				rest = rest[1:]
+				ack = append(ack, 0x80)
+			}
+			ack[1] = byte(len(ack) - 2)
+			c.Write(ack)
+
+		case mqttPingReq:
+			c.Write([]byte{mqttPingResp << 4, 0})
+
+		case mqttDisconnect:
+			return
+		}
+	}
+}
+
+// client ID and last will of CONNECT packet. false if credentials are refused
+func (b *Broker) connect(body []byte) (string, *will, bool) {
+	_, rest, err := readString(body) // protocol name
+	if err != nil || len(rest) < 4 {
+		return "", nil, false
+	}
+	flags := rest[1]
+	rest = rest[4:] // level, flags and keep alive
+
+	clientID, rest, err := readString(rest)
+	if err != nil {
+		return "", nil, false
+	}
+
+	var w *will
+	if flags&0x04 != 0 {
+		w = &will{retained: flags&0x20 != 0}
+		var topic, payload string
+		if topic, rest, err = readString(rest); err != nil {
+			return "", nil, false
+		}
+		if payload, rest, err = readString(rest); err != nil {
+			return "", nil, false
+		}
+		w.topic, w.payload = topic, []byte(payload)
+	}
+
+	var username, password string
+	if flags&0x80 != 0 {
+		if username, rest, err = readString(rest); err != nil {
+			return "", nil, false
+		}
+	}
+	if flags&0x40 != 0 {
+		if password, _, err = readString(rest); err != nil {
+			return "", nil, false
+		}
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.username != "" && (username != b.username || password != b.password) {
+		return "", nil, false
+	}
+	return clientID, w, true
+}
+
+func (b *Broker) publish(m Message) {
+	m.Time = time.Now()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.messages = append(b.messages, m)
+
+	if m.Retained {
+		if len(m.Payload) == 0 {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m.Payload
+		}
+	}
+}
+
+// message and packet ID of PUBLISH packet. packet ID is 0 for QoS 0
+func parsePublish(header byte, body []byte) (Message, uint16, error) {
+	m := Message{Retained: header&0x01 != 0}
+	qos := header >> 1 & 0x03
+
+	topic, rest, err := readString(body)
+	if err != nil {
+		return m, 0, err
+	}
+	m.Topic = topic
+
+	var id uint16
+	if qos > 0 {
+		if len(rest) < 2 {
+			return m, 0, errMalformed
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+
+	m.Payload = append([]byte(nil), rest...)
+	return m, id, nil
+}
+
+var errMalformed = errors.New("malformed MQTT packet")
+
+// fixed header byte and rest of packet
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// remaining length, 7 bits per byte
+	n, shift := 0, 0
+	for {
+		lb, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(lb&0x7F) << shift
+		if lb&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errMalformed
+		}
+	}
+
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+// length prefixed string
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errMalformed
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errMalformed
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
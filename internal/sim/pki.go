@@ -0,0 +1,124 @@
+package sim
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PKI is a throwaway CA with a PLC (server) and spectromon (client) certificate
+// signed by it, written as PEM files for tls_cert_file, tls_key_file and tls_ca_file.
+type PKI struct {
+	CAFile         string
+	ClientCertFile string
+	ClientKeyFile  string
+
+	CAs        *x509.CertPool
+	ServerCert tls.Certificate
+}
+
+// NewPKI writes CA and client certificate files to dir.
+// The server certificate is valid for 127.0.0.1 and localhost.
+func NewPKI(dir string) (*PKI, error) {
+	caKey, caCert, caDER, err := newCert("sim CA", nil, nil, func(t *x509.Certificate) {
+		t.IsCA = true
+		t.BasicConstraintsValid = true
+		t.KeyUsage = x509.KeyUsageCertSign
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	serverKey, _, serverDER, err := newCert("sim PLC", caCert, caKey, func(t *x509.Certificate) {
+		t.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		t.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+		t.DNSNames = []string{"localhost"}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientKey, _, clientDER, err := newCert("spectromon", caCert, caKey, func(t *x509.Certificate) {
+		t.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PKI{
+		CAFile:         filepath.Join(dir, "ca.pem"),
+		ClientCertFile: filepath.Join(dir, "client.pem"),
+		ClientKeyFile:  filepath.Join(dir, "client-key.pem"),
+		CAs:            x509.NewCertPool(),
+		ServerCert:     tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey},
+	}
+	p.CAs.AddCert(caCert)
+
+	if err = writePEM(p.CAFile, "CERTIFICATE", caDER); err != nil {
+		return nil, err
+	}
+	if err = writePEM(p.ClientCertFile, "CERTIFICATE", clientDER); err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = writePEM(p.ClientKeyFile, "EC PRIVATE KEY", keyDER); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// create certificate signed by parent, or self-signed if parent is nil
+func newCert(cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, setup func(*x509.Certificate)) (*ecdsa.PrivateKey, *x509.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	setup(tmpl)
+
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return key, cert, der, nil
+}
+
+func writePEM(filePath, blockType string, der []byte) error {
+	return os.WriteFile(filePath, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+}
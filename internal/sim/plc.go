@@ -0,0 +1,304 @@
+// Package sim provides in-process stand-ins for the Delta PLC, the result
+// server and an MQTT broker, so spectromon can be run end to end without hardware.
+package sim
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/simonvetter/modbus"
+)
+
+// Write records a single Modbus write request received by the PLC.
+type Write struct {
+	Time      time.Time
+	Addr      uint16
+	Coils     []bool   // for coil writes
+	Registers []uint16 // for holding register writes
+}
+
+// PLC is a Modbus TCP server that keeps coils and registers in memory
+// and records every write.
+type PLC struct {
+	URL string // for client to dial, e.g. tcp://127.0.0.1:5020
+
+	srv *modbus.ModbusServer
+
+	lock           sync.Mutex
+	coils          map[uint16]bool
+	discreteInputs map[uint16]bool
+	registers      map[uint16]uint16
+	writes         []Write
+	written        chan struct{}
+	down           bool
+	hung           chan struct{} // closed when no longer hung
+}
+
+// NewPLC starts a PLC listening on a free local port.
+func NewPLC() (*PLC, error) {
+	addr, err := freeAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	return newPLC(&modbus.ServerConfiguration{URL: "tcp://" + addr})
+}
+
+// NewTLSPLC starts a Modbus/TCP Security PLC listening on a free local port,
+// presenting serverCert and accepting clients with certificates signed by clientCAs.
+func NewTLSPLC(serverCert tls.Certificate, clientCAs *x509.CertPool) (*PLC, error) {
+	addr, err := freeAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	return newPLC(&modbus.ServerConfiguration{
+		URL:           "tcp+tls://" + addr,
+		TLSServerCert: &serverCert,
+		TLSClientCAs:  clientCAs,
+	})
+}
+
+func newPLC(conf *modbus.ServerConfiguration) (*PLC, error) {
+	p := &PLC{
+		URL:            conf.URL,
+		coils:          make(map[uint16]bool),
+		discreteInputs: make(map[uint16]bool),
+		registers:      make(map[uint16]uint16),
+		written:        make(chan struct{}),
+	}
+
+	conf.Logger = log.New(io.Discard, "", 0)
+
+	var err error
+	p.srv, err = modbus.NewServer(conf, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create modbus server: %w", err)
+	}
+
+	if err = p.srv.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start modbus server: %w", err)
+	}
+
+	return p, nil
+}
+
+func (p *PLC) Close() error {
+	return p.srv.Stop()
+}
+
+// Start listens again after Close, on the same address, with coils and registers kept.
+func (p *PLC) Start() error {
+	return p.srv.Start()
+}
+
+// SetDown makes the PLC fail all requests with a device failure exception,
+// leaving coils and registers as they are.
+func (p *PLC) SetDown(down bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.down = down
+}
+
+// SetHung makes the PLC stop answering requests, as over a stalled link,
+// until SetHung(false). Requests received while hung are answered then.
+func (p *PLC) SetHung(hung bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	switch {
+	case hung && p.hung == nil:
+		p.hung = make(chan struct{})
+	case !hung && p.hung != nil:
+		close(p.hung)
+		p.hung = nil
+	}
+}
+
+// blocks while hung. must not hold lock
+func (p *PLC) waitWhileHung() {
+	p.lock.Lock()
+	hung := p.hung
+	p.lock.Unlock()
+
+	if hung != nil {
+		<-hung
+	}
+}
+
+// Coils returns the current state of n coils from addr.
+func (p *PLC) Coils(addr, n uint16) []bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	res := make([]bool, n)
+	for i := range res {
+		res[i] = p.coils[addr+uint16(i)]
+	}
+	return res
+}
+
+// Registers returns the current value of n holding registers from addr.
+func (p *PLC) Registers(addr, n uint16) []uint16 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	res := make([]uint16, n)
+	for i := range res {
+		res[i] = p.registers[addr+uint16(i)]
+	}
+	return res
+}
+
+// Bytes returns n bytes from holding registers at addr,
+// in the order they were sent with Delta PLC encoding.
+func (p *PLC) Bytes(addr, n uint16) []byte {
+	regs := p.Registers(addr, (n+1)/2)
+
+	res := make([]byte, 0, len(regs)*2)
+	for _, r := range regs {
+		res = append(res, byte(r), byte(r>>8))
+	}
+	return res[:n]
+}
+
+func (p *PLC) SetDiscreteInput(addr uint16, value bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.discreteInputs[addr] = value
+}
+
+func (p *PLC) SetRegister(addr uint16, value uint16) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.registers[addr] = value
+}
+
+// Writes returns all writes received so far.
+func (p *PLC) Writes() []Write {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]Write(nil), p.writes...)
+}
+
+// WaitForWrite blocks until a write matching match is received, or timeout.
+// Writes already received are also considered.
+func (p *PLC) WaitForWrite(timeout time.Duration, match func(w *Write) bool) (Write, bool) {
+	deadline := time.After(timeout)
+	seen := 0
+
+	for {
+		p.lock.Lock()
+		for ; seen < len(p.writes); seen++ {
+			if match(&p.writes[seen]) {
+				w := p.writes[seen]
+				p.lock.Unlock()
+				return w, true
+			}
+		}
+		written := p.written
+		p.lock.Unlock()
+
+		select {
+		case <-written:
+		case <-deadline:
+			return Write{}, false
+		}
+	}
+}
+
+// must hold lock
+func (p *PLC) recordWrite(w Write) {
+	w.Time = time.Now()
+	p.writes = append(p.writes, w)
+
+	close(p.written)
+	p.written = make(chan struct{})
+}
+
+func (p *PLC) HandleCoils(req *modbus.CoilsRequest) ([]bool, error) {
+	p.waitWhileHung()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.down {
+		return nil, modbus.ErrServerDeviceFailure
+	}
+
+	if req.IsWrite {
+		for i, v := range req.Args {
+			p.coils[req.Addr+uint16(i)] = v
+		}
+		p.recordWrite(Write{Addr: req.Addr, Coils: append([]bool(nil), req.Args...)})
+		return nil, nil
+	}
+
+	res := make([]bool, req.Quantity)
+	for i := range res {
+		res[i] = p.coils[req.Addr+uint16(i)]
+	}
+	return res, nil
+}
+
+func (p *PLC) HandleDiscreteInputs(req *modbus.DiscreteInputsRequest) ([]bool, error) {
+	p.waitWhileHung()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.down {
+		return nil, modbus.ErrServerDeviceFailure
+	}
+
+	res := make([]bool, req.Quantity)
+	for i := range res {
+		res[i] = p.discreteInputs[req.Addr+uint16(i)]
+	}
+	return res, nil
+}
+
+func (p *PLC) HandleHoldingRegisters(req *modbus.HoldingRegistersRequest) ([]uint16, error) {
+	p.waitWhileHung()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.down {
+		return nil, modbus.ErrServerDeviceFailure
+	}
+
+	if req.IsWrite {
+		for i, v := range req.Args {
+			p.registers[req.Addr+uint16(i)] = v
+		}
+		p.recordWrite(Write{Addr: req.Addr, Registers: append([]uint16(nil), req.Args...)})
+		return nil, nil
+	}
+
+	res := make([]uint16, req.Quantity)
+	for i := range res {
+		res[i] = p.registers[req.Addr+uint16(i)]
+	}
+	return res, nil
+}
+
+func (p *PLC) HandleInputRegisters(req *modbus.InputRegistersRequest) ([]uint16, error) {
+	return nil, modbus.ErrIllegalFunction
+}
+
+// find a free local TCP port
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
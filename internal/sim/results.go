@@ -0,0 +1,214 @@
+package sim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
+)
+
+// streamKeepaliveInterval is how often result streams send a keepalive comment.
+const streamKeepaliveInterval = 200 * time.Millisecond
+
+// ResultServer stands in for the spectro result server,
+// serving the result_url, result_stream_url and time_update_url endpoints.
+type ResultServer struct {
+	srv *httptest.Server
+
+	lock        sync.Mutex
+	results     []model.Result
+	clockOffset time.Duration // served time is local time plus offset
+	down        bool
+	stalled     bool // streams send nothing, not even keepalives
+	requests    int
+	streams     map[chan []byte]struct{}
+}
+
+func NewResultServer() *ResultServer {
+	s := &ResultServer{streams: make(map[chan []byte]struct{})}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lastfurnaceresults", s.resultEndpoint)
+	mux.HandleFunc("/resultstream", s.streamEndpoint)
+	mux.HandleFunc("/gettime", s.timeEndpoint)
+	s.srv = httptest.NewServer(mux)
+
+	return s
+}
+
+func (s *ResultServer) Close() {
+	s.CloseStreams()
+	s.srv.Close()
+}
+
+func (s *ResultServer) ResultURL() string {
+	return s.srv.URL + "/lastfurnaceresults"
+}
+
+func (s *ResultServer) StreamURL() string {
+	return s.srv.URL + "/resultstream"
+}
+
+func (s *ResultServer) TimeURL() string {
+	return s.srv.URL + "/gettime"
+}
+
+// SetResults sets the latest result per furnace to be served.
+func (s *ResultServer) SetResults(results ...model.Result) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.results = results
+}
+
+// Publish pushes results as an event to all result stream subscribers.
+func (s *ResultServer) Publish(results ...model.Result) {
+	data, _ := json.Marshal(results)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for ch := range s.streams {
+		ch <- data
+	}
+}
+
+// CloseStreams drops all result stream subscribers.
+func (s *ResultServer) CloseStreams() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for ch := range s.streams {
+		close(ch)
+		delete(s.streams, ch)
+	}
+}
+
+// StallStreams keeps result streams open, but stops sending events and keepalives on them.
+func (s *ResultServer) StallStreams(stalled bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stalled = stalled
+}
+
+// SetClockOffset makes the server's clock run ahead (or behind) local time.
+func (s *ResultServer) SetClockOffset(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clockOffset = d
+}
+
+// SetDown makes all endpoints respond with 503 Service Unavailable.
+func (s *ResultServer) SetDown(down bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.down = down
+}
+
+// Requests returns the number of result requests served.
+func (s *ResultServer) Requests() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests
+}
+
+func (s *ResultServer) resultEndpoint(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.down {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.requests++
+	w.Header().Set("Date", time.Now().Add(s.clockOffset).UTC().Format(http.TimeFormat))
+
+	// only furnaces asked for
+	furnaces := r.URL.Query()["f"]
+	res := make([]model.Result, 0, len(s.results))
+	for _, result := range s.results {
+		for _, f := range furnaces {
+			if result.Furnace == f {
+				res = append(res, result)
+				break
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *ResultServer) timeEndpoint(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.down {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		T time.Time `json:"t"`
+	}{time.Now().Add(s.clockOffset)})
+}
+
+func (s *ResultServer) streamEndpoint(w http.ResponseWriter, r *http.Request) {
+	ch := make(chan []byte, 16)
+
+	s.lock.Lock()
+	if s.down {
+		s.lock.Unlock()
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+	s.streams[ch] = struct{}{}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.streams, ch)
+		s.lock.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	keepalive := time.NewTicker(streamKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case data, ok := <-ch:
+			if !ok {
+				return
+			}
+			if s.isStalled() {
+				continue
+			}
+			w.Write([]byte("data: "))
+			w.Write(data)
+			w.Write([]byte("\n\n"))
+			w.(http.Flusher).Flush()
+		case <-keepalive.C:
+			if s.isStalled() {
+				continue
+			}
+			w.Write([]byte(": keepalive\n\n"))
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *ResultServer) isStalled() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.stalled
+}
@@ -0,0 +1,73 @@
+package sim
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// SNTPServer answers SNTP requests with local time plus a settable offset.
+type SNTPServer struct {
+	Addr string // host:port to query
+
+	conn *net.UDPConn
+
+	lock   sync.Mutex
+	offset time.Duration
+}
+
+func NewSNTPServer() (*SNTPServer, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SNTPServer{Addr: conn.LocalAddr().String(), conn: conn}
+	go s.serve()
+	return s, nil
+}
+
+func (s *SNTPServer) Close() error {
+	return s.conn.Close()
+}
+
+// SetClockOffset makes the server's clock run ahead (or behind) local time.
+func (s *SNTPServer) SetClockOffset(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.offset = d
+}
+
+func (s *SNTPServer) serve() {
+	req := make([]byte, 48)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(req)
+		if err != nil {
+			return
+		}
+		if n < 48 {
+			continue
+		}
+
+		s.lock.Lock()
+		now := time.Now().Add(s.offset)
+		s.lock.Unlock()
+
+		res := make([]byte, 48)
+		res[0] = 0<<6 | 4<<3 | 4 // no leap warning, version 4, server mode
+		res[1] = 1               // stratum: primary reference
+		copy(res[12:16], "SIM")
+		copy(res[24:32], req[40:48]) // originate = client's transmit
+		putNTPTime(res[16:], now)    // reference
+		putNTPTime(res[32:], now)    // receive
+		putNTPTime(res[40:], now)    // transmit
+
+		s.conn.WriteToUDP(res, addr)
+	}
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()+2208988800))
+	binary.BigEndian.PutUint32(b[4:], uint32(int64(t.Nanosecond())<<32/1e9))
+}
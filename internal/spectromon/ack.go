@@ -0,0 +1,98 @@
+package spectromon
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/deltaplc"
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+)
+
+// poll operator acknowledge buttons on PLCs, one per furnace.
+// PLCs without modbus_address_start_ack_inputs are skipped
+func (a *app) handleAckButtons() {
+	t := time.NewTimer(ackPollInterval(a.config()))
+	lastPressed := make(map[string]bool) // per furnace
+
+	for {
+		select {
+		case <-t.C:
+			conf, plcs := a.configAndPLCs()
+
+			for _, plc := range plcs {
+				if plc.conf.ModbusAddrAckInputs == nil {
+					continue
+				}
+
+				pressed, err := a.readAckButtons(conf, plc)
+				if err != nil {
+					if !errors.Is(err, deltaplc.ErrNotConnected) {
+						log.Printf("failed to read acknowledge buttons on delta PLC %s IO over Modbus: %v", plc.conf.Name, err)
+					}
+					continue
+				}
+
+				now := time.Now()
+				for slot, i := range plc.furnaces {
+					name := conf.Furnaces[i].Name
+					if pressed[slot] && !lastPressed[name] {
+						a.acknowledge(name, now)
+					}
+					lastPressed[name] = pressed[slot]
+				}
+			}
+
+			t.Reset(ackPollInterval(conf))
+
+		case <-a.ctx.Done():
+			if !t.Stop() {
+				<-t.C
+			}
+			return
+		}
+	}
+}
+
+func ackPollInterval(c *config.Config) time.Duration {
+	if c.AckPollIntervalMs == 0 {
+		return 200 * time.Millisecond
+	}
+	return time.Duration(c.AckPollIntervalMs) * time.Millisecond
+}
+
+func (a *app) readAckButtons(c *config.Config, plc *plcIO) ([]bool, error) {
+	addr, n := *plc.conf.ModbusAddrAckInputs, uint16(len(plc.furnaces))
+
+	if c.AckInputType == config.AckHoldingRegister {
+		regs, err := plc.modbus.ReadHoldingRegisters(addr, n)
+		if err != nil {
+			return nil, err
+		}
+
+		pressed := make([]bool, len(regs))
+		for i, r := range regs {
+			pressed[i] = r != 0
+		}
+		return pressed, nil
+	}
+
+	return plc.modbus.ReadDiscreteInputs(addr, n)
+}
+
+// hold furnace's flashing lights steady for configured time, see shownLights
+func (a *app) acknowledge(furnace string, now time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if !slices.ContainsFunc(a.conf.Furnaces, func(f config.Furnace) bool { return f.Name == furnace }) {
+		return // furnace removed on reload
+	}
+
+	until := now.Add(time.Duration(a.conf.AckSilenceMinutes) * time.Minute)
+	a.furnaceAckUntil[furnace] = until
+
+	log.Printf("furnace %s alarm acknowledged by operator at %s, silenced until %s",
+		furnace, now.Format(time.DateTime), until.Format(time.DateTime))
+}
@@ -0,0 +1,50 @@
+package spectromon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
+	"github.com/RoanBrand/SpectroMonitor/internal/sim"
+)
+
+// whether coil stays as want for d
+func holds(plc *sim.PLC, addr uint16, want bool, d time.Duration) bool {
+	for end := time.Now().Add(d); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if plc.Coils(addr, 1)[0] != want {
+			return false
+		}
+	}
+	return true
+}
+
+// acknowledge holds flashing amber of comms lost steady for ack_silence_minutes, on that furnace only
+func TestAcknowledgeCommsLost(t *testing.T) {
+	results := sim.NewResultServer()
+	defer results.Close()
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S1", TimeStamp: time.Now().Add(-10 * time.Minute)})
+
+	a, plc, _ := startTestApp(t, results, map[string]any{
+		"modbus_address_start_ack_inputs": 0,
+		"ack_silence_minutes":             1,
+		"ack_poll_interval_ms":            20,
+	})
+	hf1Amber, hf2Amber := uint16(coilAmber), uint16(coilsPerFurnace+coilAmber)
+
+	results.SetDown(true)
+	waitFor(t, "comms fault coil", func() bool { return plc.Coils(testCommsFaultCoil, 1)[0] })
+	waitFor(t, "HF1 amber off", func() bool { return !plc.Coils(hf1Amber, 1)[0] })
+
+	plc.SetDiscreteInput(0, true)
+	waitFor(t, "HF1 amber on", func() bool { return plc.Coils(hf1Amber, 1)[0] })
+	plc.SetDiscreteInput(0, false)
+
+	if !holds(plc, hf1Amber, true, 5*100*time.Millisecond) {
+		t.Fatal("HF1 amber flashing after acknowledge")
+	}
+	waitFor(t, "HF2 amber off", func() bool { return !plc.Coils(hf2Amber, 1)[0] })
+
+	// acknowledge running out while comms are still lost
+	a.acknowledge("HF1", time.Now().Add(-time.Minute+200*time.Millisecond))
+	waitFor(t, "HF1 amber flashing again", func() bool { return !plc.Coils(hf1Amber, 1)[0] })
+}
@@ -0,0 +1,106 @@
+package spectromon
+
+import (
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+	"github.com/RoanBrand/SpectroMonitor/internal/timesync"
+)
+
+// time since sample, by result server's clock
+func (a *app) sampleAge(r *furnaceResult, now time.Time) time.Duration {
+	return now.Add(a.clockOffset).Sub(r.timeStamp)
+}
+
+// estimate result server's clock minus ours from serverTime,
+// which was read between sent and received. must hold lock
+func (a *app) updateClockOffset(serverTime, sent, received time.Time, resolution time.Duration) {
+	if serverTime.IsZero() {
+		return
+	}
+
+	a.setClockOffset(timesync.Estimate(serverTime, sent, received, resolution))
+}
+
+// must hold lock
+func (a *app) setClockOffset(offset time.Duration) {
+	if !a.conf.CompensateClockSkew {
+		return
+	}
+
+	offset = offset.Round(time.Millisecond)
+	if d := offset - a.clockOffset; d > time.Minute || d < -time.Minute {
+		log.Printf("clock offset to reference changed to %s", offset)
+	}
+
+	a.clockOffset = offset
+}
+
+func timeSource(c *config.Config) timesync.Source {
+	switch c.TimeSyncSource {
+	case config.TimeSyncNone:
+		return nil
+	case config.TimeSyncSNTP:
+		return &timesync.SNTP{Server: c.SNTPServer}
+	default:
+		if c.TimeUpdateUrl == "" {
+			return nil
+		}
+		return &timesync.HTTP{URL: c.TimeUpdateUrl}
+	}
+}
+
+// periodically measure offset to reference clock and
+// either step system clock or apply offset to sample ages.
+// idles while disabled, as it can be enabled on reload
+func (a *app) runTimeSyncJob() {
+	t := time.NewTimer(timeSyncInterval(a.config()))
+
+	for {
+		select {
+		case <-t.C:
+			conf := a.config()
+			if src := timeSource(conf); src != nil && conf.TimeUpdateIntervalSeconds > 0 {
+				a.syncTime(src, conf.TimeSyncMode)
+			}
+			t.Reset(timeSyncInterval(conf))
+		case <-a.ctx.Done():
+			if !t.Stop() {
+				<-t.C
+			}
+			return
+		}
+	}
+}
+
+func timeSyncInterval(c *config.Config) time.Duration {
+	if c.TimeUpdateIntervalSeconds == 0 {
+		return time.Minute // disabled, check again
+	}
+	return time.Duration(c.TimeUpdateIntervalSeconds) * time.Second
+}
+
+func (a *app) syncTime(src timesync.Source, mode string) {
+	offset, err := src.Offset(a.ctx)
+	if err != nil {
+		log.Println("unable to get time from network:", err)
+		return
+	}
+
+	if mode == config.TimeSyncSetClock {
+		if err = timesync.SetSystemClock(offset); err != nil {
+			log.Println("unable to update system time:", err)
+		} else {
+			log.Printf("stepped system clock by %s", offset)
+			offset = 0
+		}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.setClockOffset(offset)
+	a.clockOffsetSynced = true
+	a.lastTimeSync = time.Now()
+}
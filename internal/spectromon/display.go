@@ -0,0 +1,76 @@
+package spectromon
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/display"
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
+)
+
+// latest sample of a furnace
+type furnaceResult struct {
+	timeStamp  time.Time
+	sampleName string
+	results    []model.ElementResult
+}
+
+// display board text for page of furnace's latest result
+func displayPage(f *config.Furnace, r *furnaceResult, age time.Duration, page string, colon bool) []byte {
+	switch page {
+	case config.DisplayPageSample:
+		return []byte(r.sampleName)
+
+	case config.DisplayPageElement:
+		for _, er := range r.results {
+			if er.Element == f.DisplayElement {
+				return []byte(fmt.Sprintf("%s %.2f", er.Element, er.Value))
+			}
+		}
+		return []byte(f.DisplayElement + " --")
+
+	default:
+		d := age
+		if maxAge := f.AlarmAge(); d > maxAge {
+			d = maxAge
+		}
+
+		return []byte(formatDuration(d, colon))
+	}
+}
+
+// frame msg for display board into dst, followed by nonce.
+// whole frame must fit in dst's cap
+func makeDisplayStringRaw(p display.Protocol, displayAddress, nonce uint8, dst, msg []byte) {
+	dst = p.Encode(dst, displayAddress, msg)
+
+	// nonce byte is last byte written to plc that changes with each new message
+	// so that plc can know when to read a new value
+	dst = append(dst, nonce)
+}
+
+// longest message that fits in display slot with protocol framing and nonce
+func maxDisplayMsgLen(p display.Protocol, slotSize int) int {
+	return slotSize - p.FrameLen(0) - 1
+}
+
+// display protocol of each furnace, checked to fit at least the time in its slot
+func displayProtocols(c *config.Config) ([]display.Protocol, error) {
+	protocols := make([]display.Protocol, len(c.Furnaces))
+	for i := range c.Furnaces {
+		p, err := display.New(c.Furnaces[i].DisplayProtocol)
+		if err != nil {
+			return nil, err
+		}
+
+		plc := c.PLCIndex(c.Furnaces[i].PLC)
+		if plc < 0 || maxDisplayMsgLen(p, c.PLCs[plc].DisplaySlotBytes) < len("00:00") {
+			return nil, fmt.Errorf("display_slot_bytes too small for display protocol of furnace %s", c.Furnaces[i].Name)
+		}
+
+		protocols[i] = p
+	}
+
+	return protocols, nil
+}
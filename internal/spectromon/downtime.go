@@ -0,0 +1,39 @@
+package spectromon
+
+import (
+	"github.com/RoanBrand/SpectroMonitor/internal/calendar"
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+)
+
+// build downtime calendar from config and imported calendar files.
+// files that fail to import are skipped.
+func loadCalendar(c *config.Config) *calendar.Calendar {
+	var windows []calendar.Window
+
+	for i := range c.Furnaces {
+		f := &c.Furnaces[i]
+		for _, d := range f.Downtime {
+			windows = append(windows, calendar.Window{
+				Furnace: f.Name,
+				Start:   d.Start,
+				End:     d.End,
+				Reason:  d.Reason,
+				Weekly:  d.RepeatWeekly,
+				Until:   d.RepeatUntil,
+			})
+		}
+	}
+
+	for _, fp := range c.DowntimeCalendarFiles {
+		w, err := calendar.LoadFile(fp)
+		if err != nil {
+			log.Println("failed to import downtime calendar:", err)
+			continue
+		}
+
+		windows = append(windows, w...)
+	}
+
+	return calendar.New(windows)
+}
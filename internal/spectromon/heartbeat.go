@@ -0,0 +1,93 @@
+package spectromon
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/deltaplc"
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+)
+
+// last heartbeat value read from a PLC
+type plcBeat struct {
+	value   uint16
+	changed time.Time
+}
+
+// write our heartbeat to PLCs and watch each PLC's heartbeat.
+// PLCs without heartbeat addresses are skipped
+func (a *app) handleHeartbeat() {
+	t := time.NewTimer(heartbeatInterval(a.config()))
+
+	var beat uint16
+	plcBeats := make(map[string]*plcBeat)
+
+	for {
+		select {
+		case <-t.C:
+			conf, plcs := a.configAndPLCs()
+			timeout := time.Duration(conf.PLCHeartbeatTimeoutSeconds) * time.Second
+			beat++
+
+			for _, plc := range plcs {
+				name := plc.conf.Name
+
+				if addr := plc.conf.ModbusAddrHeartbeatOut; addr != nil {
+					if err := plc.modbus.WriteRegister(*addr, beat); err != nil {
+						log.Printf("failed to write heartbeat on delta PLC %s IO over Modbus: %v", name, err)
+					}
+				}
+
+				pb := plcBeats[name]
+				if pb == nil {
+					pb = &plcBeat{changed: time.Now()}
+					plcBeats[name] = pb
+				}
+
+				lost := false
+				if addr := plc.conf.ModbusAddrHeartbeatIn; addr != nil {
+					regs, err := plc.modbus.ReadHoldingRegisters(*addr, 1)
+					if err != nil {
+						if !errors.Is(err, deltaplc.ErrNotConnected) {
+							log.Printf("failed to read PLC heartbeat on delta PLC %s IO over Modbus: %v", name, err)
+						}
+					} else if regs[0] != pb.value {
+						pb.value = regs[0]
+						pb.changed = time.Now()
+					}
+
+					lost = time.Since(pb.changed) > timeout
+				} else {
+					pb.changed = time.Now()
+				}
+
+				a.lock.Lock()
+				if lost != a.plcHeartbeatLost[name] {
+					if lost {
+						log.Printf("ALARM: PLC %s heartbeat unchanged for %s, PLC program not running or unreachable", name, timeout)
+					} else {
+						log.Printf("PLC %s heartbeat restored", name)
+					}
+					a.plcHeartbeatLost[name] = lost
+				}
+				a.lock.Unlock()
+			}
+
+			t.Reset(heartbeatInterval(conf))
+
+		case <-a.ctx.Done():
+			if !t.Stop() {
+				<-t.C
+			}
+			return
+		}
+	}
+}
+
+func heartbeatInterval(c *config.Config) time.Duration {
+	if c.HeartbeatIntervalSeconds == 0 {
+		return time.Second
+	}
+	return time.Duration(c.HeartbeatIntervalSeconds) * time.Second
+}
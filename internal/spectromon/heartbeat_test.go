@@ -0,0 +1,52 @@
+package spectromon
+
+import (
+	"math/bits"
+	"testing"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
+	"github.com/RoanBrand/SpectroMonitor/internal/sim"
+)
+
+const (
+	testHeartbeatOut = 100
+	testHeartbeatIn  = 101
+)
+
+func TestHeartbeat(t *testing.T) {
+	results := sim.NewResultServer()
+	defer results.Close()
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S1", TimeStamp: time.Now()})
+
+	a, plc, _ := startTestApp(t, results, map[string]any{
+		"modbus_address_heartbeat_out":  testHeartbeatOut,
+		"modbus_address_heartbeat_in":   testHeartbeatIn,
+		"plc_heartbeat_timeout_seconds": 1,
+	})
+	lost := func() bool { return a.getStatus().PLCs[0].HeartbeatLost }
+
+	// ours counts up every second. registers are little endian, as Delta PLCs expect
+	first, ok := plc.WaitForWrite(5*time.Second, func(w *sim.Write) bool { return w.Addr == testHeartbeatOut })
+	if !ok {
+		t.Fatal("no heartbeat written")
+	}
+	if _, ok = plc.WaitForWrite(5*time.Second, func(w *sim.Write) bool {
+		return w.Addr == testHeartbeatOut && bits.ReverseBytes16(w.Registers[0]) == bits.ReverseBytes16(first.Registers[0])+1
+	}); !ok {
+		t.Fatalf("heartbeat not incremented from %d", bits.ReverseBytes16(first.Registers[0]))
+	}
+
+	// PLC's is watched while it changes, and lost once it stops
+	for beat := uint16(1); beat <= 12; beat++ {
+		plc.SetRegister(testHeartbeatIn, beat)
+		time.Sleep(200 * time.Millisecond)
+		if lost() {
+			t.Fatalf("heartbeat lost while PLC beats, at %d", beat)
+		}
+	}
+	waitFor(t, "heartbeat lost", lost)
+
+	plc.SetRegister(testHeartbeatIn, 13)
+	waitFor(t, "heartbeat restored", func() bool { return !lost() })
+}
@@ -0,0 +1,190 @@
+package spectromon
+
+import (
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+)
+
+const hornTickInterval = 100 * time.Millisecond // resolution of horn pulses
+
+// horn coil on a PLC
+type hornCoil struct {
+	plc  string
+	addr uint16
+}
+
+// drive furnace horn coils: a pulse on entering a state, per state_outputs, and the
+// horn_escalation pattern while a furnace has been red too long. horns stay silent in
+// quiet hours and while the furnace's alarm is acknowledged. horns are cleared on Stop
+func (a *app) handleHorn() {
+	t := time.NewTimer(hornTickInterval)
+	defer close(a.hornDone)
+
+	var conf *config.Config
+	lastStates := make(map[string]furnaceState)
+	pulseUntil := make(map[string]time.Time)
+	escalated := make(map[string]bool)
+	written := make(map[hornCoil]bool) // as last written
+	var lastErr string
+
+	for {
+		select {
+		case <-t.C:
+			now := time.Now()
+
+			a.lock.Lock()
+			if a.conf != conf {
+				// no pulse on first state after startup or reload
+				conf = a.conf
+				clear(lastStates)
+			}
+			plcs := a.plcs
+			quiet := conf.InQuietHours(now)
+
+			values := make(map[hornCoil]bool)
+			for _, plc := range plcs {
+				for _, i := range plc.furnaces {
+					f := &conf.Furnaces[i]
+					if f.HornCoil == nil {
+						continue
+					}
+
+					coil := hornCoil{plc.conf.Name, *f.HornCoil}
+					values[coil] = values[coil] || a.hornOn(conf, f, now, quiet, lastStates, pulseUntil, escalated)
+				}
+			}
+			a.lock.Unlock()
+
+			// coils no longer configured, e.g. after reload
+			for coil, v := range written {
+				if _, ok := values[coil]; !ok {
+					if v {
+						values[coil] = false
+					} else {
+						delete(written, coil)
+					}
+				}
+			}
+
+			a.writeHorns(plcs, values, written, &lastErr)
+			t.Reset(hornTickInterval)
+
+		case <-a.ctx.Done():
+			if !t.Stop() {
+				<-t.C
+			}
+
+			a.clearHorns()
+			return
+		}
+	}
+}
+
+// whether furnace's horn should sound. must hold lock
+func (a *app) hornOn(conf *config.Config, f *config.Furnace, now time.Time, quiet bool,
+	lastStates map[string]furnaceState, pulseUntil map[string]time.Time, escalated map[string]bool) bool {
+	state, ok := a.furnaceStates[f.Name]
+	if !ok {
+		return false
+	}
+
+	if last, seen := lastStates[f.Name]; seen && state != last {
+		pulseUntil[f.Name] = time.Time{}
+		if pulse := f.StateOutputs[state.String()].HornPulseMs; pulse > 0 {
+			pulseUntil[f.Name] = now.Add(time.Duration(pulse) * time.Millisecond)
+		}
+	}
+	lastStates[f.Name] = state
+
+	if quiet || now.Before(a.furnaceAckUntil[f.Name]) {
+		return false
+	}
+	on := now.Before(pulseUntil[f.Name])
+
+	h := &conf.HornEscalation
+	r, hasResult := a.furnaceLastResult[f.Name]
+	if len(h.PulseMs) == 0 || state != stateAlarm || !hasResult {
+		escalated[f.Name] = false
+		return on
+	}
+
+	red := a.sampleAge(&r, now) - f.AlarmAge()
+	elapsed := red - h.After()
+	if elapsed < 0 {
+		escalated[f.Name] = false
+		return on
+	}
+
+	if !escalated[f.Name] {
+		escalated[f.Name] = true
+		log.Printf("ALARM: furnace %s red for %s, sounding horn", f.Name, red.Round(time.Minute))
+	}
+
+	if h.RepeatMinutes > 0 {
+		elapsed %= h.Repeat()
+	}
+	return on || h.PatternOn(elapsed)
+}
+
+// write horn coils that changed. failed writes, and writes dropped while the PLC is not connected,
+// are retried next tick. errors are logged once
+func (a *app) writeHorns(plcs []*plcIO, values, written map[hornCoil]bool, lastErr *string) {
+	byName := make(map[string]*plcIO, len(plcs))
+	for _, plc := range plcs {
+		byName[plc.conf.Name] = plc
+	}
+
+	failed := false
+	for coil, v := range values {
+		if last, ok := written[coil]; ok && last == v {
+			continue
+		}
+
+		plc, ok := byName[coil.plc]
+		if !ok {
+			delete(written, coil) // PLC removed on reload
+			continue
+		}
+
+		// writes are dropped without error while PLC is not connected, which deltaplc logs
+		err := plc.writeOutputs(coil.addr, []bool{v})
+		if !plc.wrote(err) {
+			failed = true
+			if err != nil && err.Error() != *lastErr {
+				*lastErr = err.Error()
+				log.Printf("failed to write horn output %d on delta PLC %s: %v", coil.addr, coil.plc, err)
+			}
+			continue
+		}
+		written[coil] = v
+	}
+
+	if !failed && *lastErr != "" {
+		*lastErr = ""
+		log.Println("writing horn outputs restored")
+	}
+}
+
+// turn off all horn coils in config, so none is left sounding
+func (a *app) clearHorns() {
+	conf, plcs := a.configAndPLCs()
+
+	for _, plc := range plcs {
+		done := make(map[uint16]bool)
+		for _, i := range plc.furnaces {
+			f := &conf.Furnaces[i]
+			if f.HornCoil == nil || done[*f.HornCoil] {
+				continue
+			}
+			done[*f.HornCoil] = true
+
+			if err := plc.writeOutputs(*f.HornCoil, []bool{false}); err != nil {
+				log.Printf("failed to clear horn output %d on delta PLC %s: %v", *f.HornCoil, plc.conf.Name, err)
+			} else if !plc.modbus.Connected() {
+				log.Printf("failed to clear horn output %d on delta PLC %s: not connected", *f.HornCoil, plc.conf.Name)
+			}
+		}
+	}
+}
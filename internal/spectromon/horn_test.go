@@ -0,0 +1,165 @@
+package spectromon
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
+	"github.com/RoanBrand/SpectroMonitor/internal/sim"
+)
+
+const (
+	testWarningCoil = 21
+	testHornCoil    = 30
+)
+
+func stateOf(a *app, furnace string) furnaceState {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.furnaceStates[furnace]
+}
+
+// horn pulse due while PLC is unreachable is written once it is back
+func TestHornWrittenAfterPLCReconnect(t *testing.T) {
+	results := sim.NewResultServer()
+	defer results.Close()
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S1", TimeStamp: time.Now().Add(-45 * time.Minute)})
+
+	a, plc, _ := startTestApp(t, results, nil)
+	waitFor(t, "amber light", func() bool { return plc.Coils(0, 3)[2] })
+
+	// reload with horn on HF1, pulsed on returning to ok
+	conf := testConfig(plc, results)
+	hf1 := conf["furnaces"].([]any)[0].(map[string]any)
+	hf1["horn_coil"] = testHornCoil
+	hf1["state_outputs"] = map[string]any{
+		"ok":      map[string]any{"on": []int{20}, "horn_pulse_ms": 60000},
+		"warning": map[string]any{"on": []int{testWarningCoil}},
+	}
+	writeTestConfig(t, a.confPath, conf)
+	a.reloadConfig("test")
+
+	waitFor(t, "warning output", func() bool { return plc.Coils(testWarningCoil, 1)[0] })
+	time.Sleep(3 * hornTickInterval) // horn sees warning before ok
+
+	plc.Close()
+	waitFor(t, "PLC disconnect", func() bool {
+		_, plcs := a.configAndPLCs()
+		return !plcs[0].modbus.Connected()
+	})
+
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S2", TimeStamp: time.Now().Add(-5 * time.Minute)})
+	waitFor(t, "HF1 ok", func() bool { return stateOf(a, "HF1") == stateOK })
+	time.Sleep(3 * hornTickInterval)
+	if plc.Coils(testHornCoil, 1)[0] {
+		t.Fatal("horn written while PLC is down")
+	}
+
+	if err := plc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "horn", func() bool { return plc.Coils(testHornCoil, 1)[0] })
+}
+
+// horn coil writes on plc since writes[from:]
+func hornWrites(plc *sim.PLC, from int) []sim.Write {
+	var res []sim.Write
+	for _, w := range plc.Writes()[from:] {
+		if w.Addr == testHornCoil && len(w.Coils) == 1 {
+			res = append(res, w)
+		}
+	}
+	return res
+}
+
+// escalation pattern on a red furnace: repeated, silent in quiet hours and while acknowledged,
+// and cleared on Stop
+func TestHornEscalation(t *testing.T) {
+	results := sim.NewResultServer()
+	defer results.Close()
+
+	// red, with horn pattern starting again after lead, as it repeats every minute.
+	// each sample is newer than the last
+	sample := 0
+	redRepeatingIn := func(lead time.Duration) {
+		sample++
+		results.SetResults(model.Result{
+			Furnace:    "HF1",
+			SampleName: fmt.Sprintf("S%d", sample),
+			TimeStamp:  time.Now().Add(-61*time.Minute + lead),
+		})
+	}
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S0", TimeStamp: time.Now().Add(-61*time.Minute - 30*time.Second)})
+
+	a, plc, stop := startTestApp(t, results, nil)
+	waitFor(t, "red light", func() bool { return plc.Coils(0, 3)[0] })
+
+	reload := func(pulseMs []int, quietHours []map[string]string) {
+		conf := testConfig(plc, results)
+		conf["furnaces"].([]any)[0].(map[string]any)["horn_coil"] = testHornCoil
+		conf["horn_escalation"] = map[string]any{"after_minutes": 0, "pulse_ms": pulseMs, "repeat_minutes": 1}
+		conf["horn_quiet_hours"] = quietHours
+		writeTestConfig(t, a.confPath, conf)
+		a.reloadConfig("test")
+	}
+	pattern := []int{1000, 600, 1000}
+	reload(pattern, nil)
+	waitFor(t, "horn off", func() bool { return len(hornWrites(plc, 0)) > 0 })
+
+	// pattern of on, off, on, once per repeat
+	from := len(plc.Writes())
+	redRepeatingIn(2 * time.Second)
+	waitFor(t, "horn pattern", func() bool { return len(hornWrites(plc, from)) >= 4 })
+	ws := hornWrites(plc, from)
+	for i, w := range ws[:4] {
+		if on := i%2 == 0; w.Coils[0] != on {
+			t.Fatalf("horn write %d is %t, want %t", i, w.Coils[0], on)
+		}
+		if i == 0 {
+			continue
+		}
+		want := time.Duration(pattern[i-1]) * time.Millisecond
+		if d := w.Time.Sub(ws[i-1].Time); d < want-4*hornTickInterval || d > want+4*hornTickInterval {
+			t.Errorf("horn %t for %s, want %s", ws[i-1].Coils[0], d, want)
+		}
+	}
+	if !holds(plc, testHornCoil, false, time.Second) {
+		t.Fatal("horn sounding after pattern")
+	}
+
+	// acknowledge silences pattern in progress
+	redRepeatingIn(2 * time.Second)
+	waitFor(t, "horn", func() bool { return plc.Coils(testHornCoil, 1)[0] })
+	a.acknowledge("HF1", time.Now())
+	waitFor(t, "horn silenced", func() bool { return !plc.Coils(testHornCoil, 1)[0] })
+	if !holds(plc, testHornCoil, false, 3*time.Second) {
+		t.Fatal("horn sounding while acknowledged")
+	}
+	a.acknowledge("HF1", time.Now().Add(-time.Hour))
+
+	// quiet hours ending 2 minutes from now, having started past midnight
+	// (unless that is within 3 minutes of midnight)
+	now := time.Now()
+	reload(pattern, []map[string]string{{
+		"start": now.Add(3 * time.Minute).Format("15:04"),
+		"end":   now.Add(2 * time.Minute).Format("15:04"),
+	}})
+	from = len(plc.Writes())
+	redRepeatingIn(2 * time.Second)
+	if !holds(plc, testHornCoil, false, 5*time.Second) {
+		t.Fatal("horn sounding in quiet hours")
+	}
+	if n := len(hornWrites(plc, from)); n != 0 {
+		t.Fatalf("got %d horn writes in quiet hours", n)
+	}
+
+	// horn left on is cleared
+	reload([]int{30000}, nil)
+	redRepeatingIn(2 * time.Second)
+	waitFor(t, "horn", func() bool { return plc.Coils(testHornCoil, 1)[0] })
+	stop()
+	if plc.Coils(testHornCoil, 1)[0] {
+		t.Fatal("horn on after Stop")
+	}
+}
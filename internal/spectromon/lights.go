@@ -0,0 +1,146 @@
+package spectromon
+
+import (
+	"slices"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+)
+
+// what a furnace's lights indicate
+type furnaceState uint8
+
+const (
+	stateNoResult furnaceState = iota
+	stateOK
+	stateWarning
+	stateAlarm
+	stateDowntime
+	stateCommsLost
+)
+
+var stateNames = [...]string{"no_result", "ok", "warning", "alarm", "downtime", "comms_lost"}
+
+func (s furnaceState) String() string {
+	return stateNames[s]
+}
+
+type lightPattern uint8
+
+const (
+	patternOff lightPattern = iota
+	patternOn
+	patternFlash // toggles every light_flash_interval_ms
+)
+
+var patternNames = [...]string{"off", "on", "flash"}
+
+func (p lightPattern) String() string {
+	return patternNames[p]
+}
+
+// render light patterns into coil values for the current flash phase
+func renderLights(dst []bool, patterns []lightPattern, phase bool) {
+	for i, p := range patterns {
+		switch p {
+		case patternOn:
+			dst[i] = true
+		case patternFlash:
+			dst[i] = phase
+		default:
+			dst[i] = false
+		}
+	}
+}
+
+// light patterns of furnace i as shown, with flashing held steady while acknowledged. must hold lock
+func (a *app) shownLights(i int, now time.Time) []lightPattern {
+	lights := slices.Clone(a.lights[i*coilsPerFurnace : (i+1)*coilsPerFurnace])
+	if now.Before(a.furnaceAckUntil[a.conf.Furnaces[i].Name]) {
+		for j := range lights {
+			if lights[j] == patternFlash {
+				lights[j] = patternOn
+			}
+		}
+	}
+	return lights
+}
+
+// send light patterns set by doTask to sinks, and comms fault to PLCs
+func (a *app) handleLights() {
+	t := time.NewTimer(flashInterval(a.config()))
+	phase := true
+
+	faultWritten := make(map[string]bool) // per PLC, fault last written to it
+
+	for {
+		select {
+		case <-t.C:
+			a.lock.Lock()
+			conf, plcs, sinks := a.conf, a.plcs, a.sinks
+
+			now := time.Now()
+			states := make([]furnaceState, len(conf.Furnaces))
+			lights := make([]lightPattern, 0, len(a.lights))
+			for i := range conf.Furnaces {
+				states[i] = a.furnaceStates[conf.Furnaces[i].Name]
+				lights = append(lights, a.shownLights(i, now)...)
+			}
+
+			dirty := a.lightsDirty
+			a.lightsDirty = false
+			fault := a.commsLost
+			a.lock.Unlock()
+
+			for _, s := range sinks {
+				for i := range conf.Furnaces {
+					s.SetFurnaceState(conf.Furnaces[i].Name, states[i], lights[i*coilsPerFurnace:(i+1)*coilsPerFurnace], phase)
+				}
+
+				// sinks only send changes, unless doTask has new results
+				if err := s.Flush(dirty); err != nil {
+					log.Printf("failed to update furnace lights on %s: %v", s.Name(), err)
+				}
+			}
+
+			for _, plc := range plcs {
+				name := plc.conf.Name
+
+				addr := plc.conf.ModbusAddrCommsFaultCoil
+				if addr == nil {
+					continue
+				}
+
+				// retried every flash until PLC has it
+				if written, ok := faultWritten[name]; dirty || !ok || written != fault {
+					err := plc.writeOutputs(*addr, []bool{fault})
+					if err != nil {
+						log.Printf("failed to set comms fault output on delta PLC %s IO over Modbus: %v", name, err)
+					}
+					if plc.wrote(err) {
+						faultWritten[name] = fault
+					} else {
+						delete(faultWritten, name)
+					}
+				}
+			}
+
+			phase = !phase
+			t.Reset(flashInterval(conf))
+
+		case <-a.ctx.Done():
+			if !t.Stop() {
+				<-t.C
+			}
+			return
+		}
+	}
+}
+
+func flashInterval(c *config.Config) time.Duration {
+	if c.LightFlashIntervalMs == 0 {
+		return 500 * time.Millisecond
+	}
+	return time.Duration(c.LightFlashIntervalMs) * time.Millisecond
+}
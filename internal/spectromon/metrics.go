@@ -0,0 +1,84 @@
+package spectromon
+
+import (
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	resultFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "spectromon_result_fetch_duration_seconds",
+		Help:    "Time taken to get latest furnace results from result_url, by result (success, failure).",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"result"})
+
+	resultFetchErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "spectromon_result_fetch_errors_total",
+		Help: "Failed requests for latest furnace results.",
+	})
+
+	furnaceSampleAgeDesc = prometheus.NewDesc(
+		"spectromon_furnace_sample_age_seconds",
+		"Time since furnace's last sample.",
+		[]string{"furnace"}, nil)
+
+	furnaceStateDesc = prometheus.NewDesc(
+		"spectromon_furnace_state",
+		"Current state of furnace's lights. 1 for the active state.",
+		[]string{"furnace", "state"}, nil)
+)
+
+func observeResultFetch(start time.Time, err error) {
+	if err != nil {
+		resultFetchErrors.Inc()
+		resultFetchDuration.WithLabelValues("failure").Observe(time.Since(start).Seconds())
+	} else {
+		resultFetchDuration.WithLabelValues("success").Observe(time.Since(start).Seconds())
+	}
+}
+
+// collects furnace state from app on scrape
+type furnaceCollector struct {
+	a *app
+}
+
+func (a *app) registerMetrics() {
+	if err := prometheus.Register(furnaceCollector{a}); err != nil {
+		log.Println("failed to register furnace metrics:", err)
+	}
+}
+
+func (c furnaceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- furnaceSampleAgeDesc
+	ch <- furnaceStateDesc
+}
+
+func (c furnaceCollector) Collect(ch chan<- prometheus.Metric) {
+	a := c.a
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := time.Now()
+	for i := range a.conf.Furnaces {
+		f := &a.conf.Furnaces[i]
+
+		if r, ok := a.furnaceLastResult[f.Name]; ok {
+			ch <- prometheus.MustNewConstMetric(furnaceSampleAgeDesc, prometheus.GaugeValue,
+				a.sampleAge(&r, now).Seconds(), f.Name)
+		}
+
+		current := a.furnaceStates[f.Name]
+		for s, name := range stateNames {
+			var v float64
+			if furnaceState(s) == current {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(furnaceStateDesc, prometheus.GaugeValue, v, f.Name, name)
+		}
+	}
+}
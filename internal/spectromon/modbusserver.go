@@ -0,0 +1,193 @@
+package spectromon
+
+import (
+	stdlog "log"
+	"slices"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+
+	"github.com/simonvetter/modbus"
+)
+
+// Modbus TCP server for SCADA and HMIs to poll furnace state, at modbus_server_url.
+// Holding registers (FC 3) and input registers (FC 4) serve the same read-only map.
+// 32 bit values are high word first. Times are unix seconds, 0 if none.
+//
+// General, from register 0:
+//
+//	0    map version, currently 1
+//	1    number of furnaces
+//	2    health bits: 0 result server comms lost, 1 result stream up,
+//	     2 a PLC disconnected, 3 a PLC heartbeat lost, 4 a PLC out of sync
+//	3    consecutive failed result polls
+//	4-5  time of last result fetch
+//	6-7  current time
+//
+// Per furnace, in config order, 16 registers from 100 + 16 * furnace index:
+//
+//	+0    state: 0 no result, 1 ok, 2 warning, 3 alarm, 4 downtime, 5 comms lost
+//	+1    red light: 0 off, 1 on, 2 flashing
+//	+2    green light
+//	+3    amber light
+//	+4-5  last sample time
+//	+6    last sample age in minutes, by result server's clock. 65535 if none
+//	+7    1 if alarm acknowledged by operator
+//	+8    health bits: 0 result server comms lost, 1 PLC disconnected,
+//	      2 PLC heartbeat lost, 3 PLC out of sync
+const (
+	modbusMapVersion = 1
+
+	regFurnacesStart = 100
+	regsPerFurnace   = 16
+)
+
+func (a *app) startModbusServer() {
+	url := a.config().ModbusServerURL
+	if url == "" {
+		return
+	}
+
+	srv, err := modbus.NewServer(&modbus.ServerConfiguration{
+		URL:    url,
+		Logger: stdlog.Default(),
+	}, modbusHandler{a})
+	if err != nil {
+		log.Println("invalid modbus server config:", err)
+		return
+	}
+
+	if err = srv.Start(); err != nil {
+		log.Println("failed to start modbus server:", err)
+		return
+	}
+
+	a.lock.Lock()
+	a.modbusServer = srv
+	a.lock.Unlock()
+}
+
+func (a *app) stopModbusServer() error {
+	a.lock.Lock()
+	srv := a.modbusServer
+	a.lock.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Stop()
+}
+
+// serves register map from status
+type modbusHandler struct {
+	a *app
+}
+
+func (h modbusHandler) HandleHoldingRegisters(req *modbus.HoldingRegistersRequest) ([]uint16, error) {
+	if req.IsWrite {
+		return nil, modbus.ErrIllegalFunction
+	}
+	return h.readRegisters(req.Addr, req.Quantity)
+}
+
+func (h modbusHandler) HandleInputRegisters(req *modbus.InputRegistersRequest) ([]uint16, error) {
+	return h.readRegisters(req.Addr, req.Quantity)
+}
+
+func (h modbusHandler) HandleCoils(req *modbus.CoilsRequest) ([]bool, error) {
+	return nil, modbus.ErrIllegalFunction
+}
+
+func (h modbusHandler) HandleDiscreteInputs(req *modbus.DiscreteInputsRequest) ([]bool, error) {
+	return nil, modbus.ErrIllegalFunction
+}
+
+func (h modbusHandler) readRegisters(addr, quantity uint16) ([]uint16, error) {
+	st := h.a.getStatus()
+	regs := statusRegisters(&st)
+
+	if int(addr)+int(quantity) > len(regs) {
+		return nil, modbus.ErrIllegalDataAddress
+	}
+	return regs[addr : addr+quantity], nil
+}
+
+// register map of status, see above
+func statusRegisters(st *status) []uint16 {
+	regs := make([]uint16, regFurnacesStart+regsPerFurnace*len(st.Furnaces))
+
+	plcHealth := make(map[string]uint16, len(st.PLCs))
+	var anyPLCHealth uint16
+	for _, p := range st.PLCs {
+		var bits uint16
+		if !p.Connected {
+			bits |= 1 << 1
+		}
+		if p.HeartbeatLost {
+			bits |= 1 << 2
+		}
+		if !p.InSync {
+			bits |= 1 << 3
+		}
+		plcHealth[p.Name] = bits
+		anyPLCHealth |= bits
+	}
+
+	var commsLost uint16
+	if st.CommsLost {
+		commsLost = 1
+	}
+
+	regs[0] = modbusMapVersion
+	regs[1] = uint16(len(st.Furnaces))
+	regs[2] = commsLost | anyPLCHealth<<1 // furnace PLC bits 1-3 are general bits 2-4
+	if st.ResultStreamUp {
+		regs[2] |= 1 << 1
+	}
+	regs[3] = saturate(st.FailedPolls)
+	putTime(regs[4:], st.LastResultFetch)
+	putTime(regs[6:], &st.Time)
+
+	for i := range st.Furnaces {
+		fs := &st.Furnaces[i]
+		r := regs[regFurnacesStart+regsPerFurnace*i:]
+
+		r[0] = uint16(max(slices.Index(stateNames[:], fs.State), 0))
+		r[1] = lightRegister(fs.Lights["red"])
+		r[2] = lightRegister(fs.Lights["green"])
+		r[3] = lightRegister(fs.Lights["amber"])
+		putTime(r[4:], fs.LastSampleTime)
+
+		r[6] = 0xFFFF
+		if fs.AgeMinutes != nil {
+			r[6] = saturate(int(*fs.AgeMinutes))
+		}
+
+		if fs.AcknowledgedUntil != nil {
+			r[7] = 1
+		}
+
+		r[8] = commsLost | plcHealth[fs.PLC]
+	}
+
+	return regs
+}
+
+func lightRegister(pattern string) uint16 {
+	return uint16(max(slices.Index(patternNames[:], pattern), 0))
+}
+
+// clamp to register range
+func saturate(v int) uint16 {
+	return uint16(min(max(v, 0), 0xFFFE))
+}
+
+// unix seconds as 2 registers, high word first
+func putTime(dst []uint16, t *time.Time) {
+	if t == nil {
+		return
+	}
+
+	u := uint32(t.Unix())
+	dst[0], dst[1] = uint16(u>>16), uint16(u)
+}
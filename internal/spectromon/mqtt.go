@@ -0,0 +1,257 @@
+package spectromon
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	mqttPublishInterval = time.Second     // how often furnace state is checked for changes
+	mqttTimeout         = 5 * time.Second // connect and publish
+)
+
+var mqttRetryInterval = 10 * time.Second // between attempts to connect to broker. shortened by tests
+
+// furnace state published as JSON to spectro/<site>/<furnace>/state
+type mqttFurnaceState struct {
+	State          string     `json:"state"`
+	Light          string     `json:"light"` // lit light: "red", "amber", "green" or "off"
+	Flashing       bool       `json:"flashing"`
+	AgeMinutes     *int       `json:"age_minutes,omitempty"`
+	LastSampleName string     `json:"last_sample_name,omitempty"`
+	LastSampleTime *time.Time `json:"last_sample_time,omitempty"`
+}
+
+// publish furnace state to MQTT broker whenever it changes.
+// broker being down only delays publishing, state is published in full on every connect
+func (a *app) handleMQTT() {
+	mc := a.config().MQTT
+	if mc.BrokerURL == "" {
+		return
+	}
+
+	client, err := newMQTTClient(&mc)
+	if err != nil {
+		log.Println("MQTT publishing disabled:", err)
+		return
+	}
+
+	a.lock.Lock()
+	a.mqtt, a.mqttSite = client, mc.Site
+	a.lock.Unlock()
+
+	t := time.NewTimer(0)
+	var lastAttempt time.Time
+	var lastErr string
+	published := make(map[string][]byte) // last state payload per furnace
+
+	for {
+		select {
+		case <-t.C:
+			all := false
+			if !client.IsConnectionOpen() && time.Since(lastAttempt) >= mqttRetryInterval {
+				lastAttempt = time.Now()
+				all = connectMQTT(client, &mc, &lastErr)
+			}
+
+			if client.IsConnectionOpen() {
+				a.publishFurnaceStates(client, mc.Site, published, all)
+			}
+
+			t.Reset(mqttPublishInterval)
+
+		case <-a.ctx.Done():
+			if !t.Stop() {
+				<-t.C
+			}
+			return
+		}
+	}
+}
+
+func newMQTTClient(mc *config.MQTT) (mqtt.Client, error) {
+	opts := mqtt.NewClientOptions().
+		AddBroker(mc.BrokerURL).
+		SetClientID(mc.ClientID).
+		SetUsername(mc.Username).
+		SetPassword(mc.Password).
+		SetWill(mqttStatusTopic(mc.Site), "offline", 1, true).
+		SetAutoReconnect(false). // reconnected by handleMQTT, to republish state
+		SetConnectTimeout(mqttTimeout).
+		SetWriteTimeout(mqttTimeout).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Println("lost connection to MQTT broker:", err)
+		})
+
+	tlsConf, err := mqttTLSConfig(mc)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConf != nil {
+		opts.SetTLSConfig(tlsConf)
+	}
+
+	return mqtt.NewClient(opts), nil
+}
+
+// nil if no TLS files are set, for system CAs
+func mqttTLSConfig(mc *config.MQTT) (*tls.Config, error) {
+	if mc.TLSCertFile == "" && mc.TLSCAFile == "" {
+		return nil, nil
+	}
+
+	conf := &tls.Config{}
+
+	if mc.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(mc.TLSCertFile, mc.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load MQTT TLS client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if mc.TLSCAFile != "" {
+		pem, err := os.ReadFile(mc.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load MQTT TLS CA file: %w", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in MQTT TLS CA file %s", mc.TLSCAFile)
+		}
+	}
+
+	return conf, nil
+}
+
+// connect and announce online. errors are logged once, until connected
+func connectMQTT(client mqtt.Client, mc *config.MQTT, lastErr *string) bool {
+	err := waitMQTT(client.Connect())
+	if err == nil {
+		err = publishMQTT(client, mqttStatusTopic(mc.Site), []byte("online"))
+	}
+
+	if err != nil {
+		if err.Error() != *lastErr {
+			*lastErr = err.Error()
+			log.Printf("error connecting to MQTT broker at %s: %v", mc.BrokerURL, err)
+		}
+		client.Disconnect(0)
+		return false
+	}
+
+	*lastErr = ""
+	log.Println("connected to MQTT broker at", mc.BrokerURL)
+	return true
+}
+
+// publish state of furnaces that changed, or all. state of furnaces removed from config is cleared
+func (a *app) publishFurnaceStates(client mqtt.Client, site string, published map[string][]byte, all bool) {
+	st := a.getStatus()
+	current := make(map[string]bool, len(st.Furnaces))
+
+	for i := range st.Furnaces {
+		fs := &st.Furnaces[i]
+		current[fs.Name] = true
+
+		payload, err := json.Marshal(newMQTTFurnaceState(fs))
+		if err != nil {
+			log.Println("failed to encode furnace state for MQTT:", err)
+			continue
+		}
+		if !all && bytes.Equal(payload, published[fs.Name]) {
+			continue
+		}
+
+		if err = publishMQTT(client, mqttStateTopic(site, fs.Name), payload); err != nil {
+			log.Printf("failed to publish state of furnace %s to MQTT broker: %v", fs.Name, err)
+			continue
+		}
+		published[fs.Name] = payload
+	}
+
+	for name := range published {
+		if current[name] {
+			continue
+		}
+
+		// empty retained message removes it from broker
+		if err := publishMQTT(client, mqttStateTopic(site, name), nil); err != nil {
+			log.Printf("failed to clear state of removed furnace %s on MQTT broker: %v", name, err)
+			continue
+		}
+		delete(published, name)
+	}
+}
+
+func newMQTTFurnaceState(fs *furnaceStatus) mqttFurnaceState {
+	s := mqttFurnaceState{
+		State:          fs.State,
+		Light:          "off",
+		LastSampleName: fs.LastSampleName,
+		LastSampleTime: fs.LastSampleTime,
+	}
+
+	for _, colour := range []string{"red", "amber", "green"} {
+		if p := fs.Lights[colour]; p != patternOff.String() {
+			s.Light = colour
+			s.Flashing = p == patternFlash.String()
+			break
+		}
+	}
+
+	// whole minutes, so state changes at most once a minute while waiting for a sample
+	if fs.AgeMinutes != nil {
+		age := int(*fs.AgeMinutes)
+		s.AgeMinutes = &age
+	}
+
+	return s
+}
+
+// retained, at least once
+func publishMQTT(client mqtt.Client, topic string, payload []byte) error {
+	return waitMQTT(client.Publish(topic, 1, true, payload))
+}
+
+func waitMQTT(t mqtt.Token) error {
+	if !t.WaitTimeout(mqttTimeout) {
+		return errors.New("timed out")
+	}
+	return t.Error()
+}
+
+func mqttStateTopic(site, furnace string) string {
+	return "spectro/" + site + "/" + furnace + "/state"
+}
+
+func mqttStatusTopic(site string) string {
+	return "spectro/" + site + "/status"
+}
+
+// announce offline and disconnect, as last will is only sent by broker if connection drops
+func (a *app) stopMQTT() {
+	a.lock.Lock()
+	client, site := a.mqtt, a.mqttSite
+	a.lock.Unlock()
+
+	if client == nil || !client.IsConnectionOpen() {
+		return
+	}
+
+	if err := publishMQTT(client, mqttStatusTopic(site), []byte("offline")); err != nil {
+		log.Println("failed to publish offline status to MQTT broker:", err)
+	}
+	client.Disconnect(250)
+}
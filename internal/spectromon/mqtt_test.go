@@ -0,0 +1,169 @@
+package spectromon
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
+	"github.com/RoanBrand/SpectroMonitor/internal/sim"
+)
+
+func init() {
+	mqttRetryInterval = 100 * time.Millisecond
+}
+
+const testSite = "test"
+
+// start spectromon publishing to a simulated broker, with HF1's sample age as given
+func startMQTTTestApp(t *testing.T, age time.Duration) (*app, *sim.Broker, *sim.ResultServer, func()) {
+	t.Helper()
+
+	broker, err := sim.NewBroker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { broker.Close() })
+
+	results := sim.NewResultServer()
+	t.Cleanup(results.Close)
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S1", TimeStamp: time.Now().Add(-age)})
+
+	a, _, stop := startTestApp(t, results, map[string]any{
+		"mqtt": map[string]any{"broker_url": broker.URL, "site": testSite},
+	})
+	return a, broker, results, stop
+}
+
+// retained state of furnace, zero if none
+func retainedState(t *testing.T, b *sim.Broker, furnace string) mqttFurnaceState {
+	t.Helper()
+
+	var s mqttFurnaceState
+	p, ok := b.Retained(mqttStateTopic(testSite, furnace))
+	if !ok {
+		return s
+	}
+	if err := json.Unmarshal(p, &s); err != nil {
+		t.Fatalf("state of %s: %v", furnace, err)
+	}
+	return s
+}
+
+func retainedStatus(b *sim.Broker) string {
+	p, _ := b.Retained(mqttStatusTopic(testSite))
+	return string(p)
+}
+
+// whether a message on topic was received after t
+func publishedSince(b *sim.Broker, topic string, t time.Time) bool {
+	for _, m := range b.Messages() {
+		if m.Topic == topic && m.Time.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMQTTPublishesState(t *testing.T) {
+	_, broker, results, stop := startMQTTTestApp(t, 45*time.Minute)
+
+	waitFor(t, "online status", func() bool { return retainedStatus(broker) == "online" })
+	waitFor(t, "HF1 warning", func() bool {
+		s := retainedState(t, broker, "HF1")
+		return s.State == "warning" && s.Light == "amber" && s.AgeMinutes != nil && *s.AgeMinutes == 45 && s.LastSampleName == "S1"
+	})
+	waitFor(t, "HF2 no result", func() bool { return retainedState(t, broker, "HF2").State == "no_result" })
+
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S2", TimeStamp: time.Now().Add(-5 * time.Minute)})
+	waitFor(t, "HF1 ok", func() bool {
+		s := retainedState(t, broker, "HF1")
+		return s.State == "ok" && s.Light == "green" && !s.Flashing && s.LastSampleName == "S2"
+	})
+
+	stop()
+	if got := retainedStatus(broker); got != "offline" {
+		t.Errorf("status after stop %q, want offline", got)
+	}
+	for _, m := range broker.Messages() {
+		if m.Will {
+			t.Errorf("last will published on clean stop: %s %s", m.Topic, m.Payload)
+		}
+	}
+}
+
+func TestMQTTLastWill(t *testing.T) {
+	_, broker, _, _ := startMQTTTestApp(t, 10*time.Minute)
+	waitFor(t, "HF1 state", func() bool { return retainedState(t, broker, "HF1").State == "ok" })
+
+	dropped := time.Now()
+	broker.DropClients()
+
+	waitFor(t, "last will", func() bool {
+		for _, m := range broker.Messages() {
+			if m.Will && m.Topic == mqttStatusTopic(testSite) && string(m.Payload) == "offline" && m.Retained {
+				return true
+			}
+		}
+		return false
+	})
+
+	// state is republished in full on reconnect, even though unchanged
+	waitFor(t, "state republished", func() bool {
+		return publishedSince(broker, mqttStateTopic(testSite, "HF1"), dropped) &&
+			publishedSince(broker, mqttStateTopic(testSite, "HF3"), dropped)
+	})
+	waitFor(t, "online again", func() bool { return retainedStatus(broker) == "online" })
+}
+
+func TestMQTTBrokerDown(t *testing.T) {
+	_, broker, results, _ := startMQTTTestApp(t, 90*time.Minute)
+	waitFor(t, "HF1 alarm", func() bool { return retainedState(t, broker, "HF1").State == "alarm" })
+
+	broker.SetDown(true)
+
+	// changes while broker is down are published once it is back
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S2", TimeStamp: time.Now().Add(-5 * time.Minute)})
+	time.Sleep(2 * mqttPublishInterval)
+	if s := retainedState(t, broker, "HF1"); s.State != "alarm" {
+		t.Fatalf("state %q published while broker down", s.State)
+	}
+
+	up := time.Now()
+	broker.SetDown(false)
+
+	waitFor(t, "HF1 ok", func() bool {
+		s := retainedState(t, broker, "HF1")
+		return s.State == "ok" && s.Light == "green" && s.LastSampleName == "S2"
+	})
+	waitFor(t, "state republished", func() bool {
+		return publishedSince(broker, mqttStateTopic(testSite, "HF2"), up) &&
+			publishedSince(broker, mqttStatusTopic(testSite), up)
+	})
+}
+
+func TestMQTTRemovedFurnace(t *testing.T) {
+	a, broker, _, _ := startMQTTTestApp(t, 10*time.Minute)
+	waitFor(t, "HF3 state", func() bool { return retainedState(t, broker, "HF3").State == "no_result" })
+
+	data, err := os.ReadFile(a.confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf map[string]any
+	if err = json.Unmarshal(data, &conf); err != nil {
+		t.Fatal(err)
+	}
+	conf["furnaces"] = conf["furnaces"].([]any)[:2]
+	writeTestConfig(t, a.confPath, conf)
+	a.reloadConfig("test")
+
+	waitFor(t, "HF3 state cleared", func() bool {
+		_, ok := broker.Retained(mqttStateTopic(testSite, "HF3"))
+		return !ok
+	})
+	if s := retainedState(t, broker, "HF1"); s.State != "ok" {
+		t.Errorf("HF1 state %q after reload, want ok", s.State)
+	}
+}
@@ -0,0 +1,104 @@
+package spectromon
+
+import (
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/deltaplc"
+
+	"github.com/simonvetter/modbus"
+)
+
+// connection to a PLC and the furnaces it drives
+type plcIO struct {
+	conf     *config.PLC
+	modbus   *deltaplc.Modbus
+	furnaces []int // indexes into config furnaces, in order of their coil and register blocks
+}
+
+// connect to PLCs in config, reusing connections in current with same name and URL.
+// returns connections in current that are no longer used, to be closed.
+func connectPLCs(c *config.Config, current []*plcIO) ([]*plcIO, []*deltaplc.Modbus, error) {
+	existing := make(map[string]*plcIO, len(current))
+	for _, p := range current {
+		existing[p.conf.Name] = p
+	}
+
+	plcs := make([]*plcIO, len(c.PLCs))
+	var opened []*deltaplc.Modbus
+
+	for i := range c.PLCs {
+		pc := &c.PLCs[i]
+
+		var m *deltaplc.Modbus
+		if p, ok := existing[pc.Name]; ok && p.conf.ModbusURL == pc.ModbusURL && p.conf.ModbusClient == pc.ModbusClient {
+			m = p.modbus
+			delete(existing, pc.Name)
+		} else {
+			var err error
+			if m, err = deltaplc.New(pc.Name, pc.ModbusURL, modbusOptions(&pc.ModbusClient)); err != nil {
+				for _, m := range opened {
+					m.Close()
+				}
+				return nil, nil, err
+			}
+			opened = append(opened, m)
+		}
+
+		m.SetVerify(c.ModbusVerifyWrites, c.ModbusVerifyRetries)
+		plcs[i] = &plcIO{conf: pc, modbus: m, furnaces: c.FurnacesOn(pc.Name)}
+	}
+
+	unused := make([]*deltaplc.Modbus, 0, len(existing))
+	for _, p := range existing {
+		unused = append(unused, p.modbus)
+	}
+
+	return plcs, unused, nil
+}
+
+func modbusOptions(mc *config.ModbusClient) deltaplc.Options {
+	opts := deltaplc.Options{
+		BaudRate:     mc.BaudRate,
+		DataBits:     mc.DataBits,
+		StopBits:     mc.StopBits,
+		UnitID:       mc.UnitID,
+		Timeout:      time.Duration(mc.TimeoutMs) * time.Millisecond,
+		TLSCertFile:  mc.TLSCertFile,
+		TLSKeyFile:   mc.TLSKeyFile,
+		TLSCAFile:    mc.TLSCAFile,
+		BigEndian:    mc.Endianness == config.BigEndian,
+		LowWordFirst: mc.WordOrder == config.LowWordFirst,
+	}
+
+	switch mc.Parity {
+	case config.ParityEven:
+		opts.Parity = modbus.PARITY_EVEN
+	case config.ParityOdd:
+		opts.Parity = modbus.PARITY_ODD
+	default:
+		opts.Parity = modbus.PARITY_NONE
+	}
+
+	return opts
+}
+
+// write on/off outputs as coils or holding registers, per PLC's output_type
+func (p *plcIO) writeOutputs(addr uint16, values []bool) error {
+	if p.conf.OutputType != config.OutputHoldingRegister {
+		return p.modbus.WriteCoils(addr, values)
+	}
+
+	regs := make([]uint16, len(values))
+	for i, v := range values {
+		if v {
+			regs[i] = 1
+		}
+	}
+	return p.modbus.WriteRegisters(addr, regs)
+}
+
+// whether a write that returned err reached the PLC, as writes are dropped without error while not connected
+func (p *plcIO) wrote(err error) bool {
+	return err == nil && p.modbus.Connected()
+}
@@ -0,0 +1,253 @@
+package spectromon
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/display"
+)
+
+// drives light outputs and display boards of the furnaces on a Delta PLC.
+// each furnace has a display slot of registers, in order of furnaces on PLC.
+// furnaces with state_outputs drive those coils, others a block of red, green and amber coils.
+// horn coils are driven by handleHorn
+type plcSink struct {
+	plc *plcIO
+
+	slots      map[string]int     // display slot of furnace on PLC
+	protocols  []display.Protocol // per slot
+	boards     []uint8            // display board address per slot
+	slotBytes  int
+	lightSlots map[string]int             // block of lights of furnace without state_outputs
+	mapped     map[string]*config.Furnace // furnaces with state_outputs
+	stateRuns  [][]uint16                 // state output addresses, in runs of consecutive addresses
+
+	lock       sync.Mutex
+	lights     []lightPattern // per coil of light blocks
+	flashOn    bool
+	lastCoils  []bool
+	display    []byte
+	nonces     []uint8 // per slot, changed with each new display message
+	textShown  bool    // since last flush
+	lightsSent bool    // at least once
+
+	states     map[string]furnaceState // of mapped furnaces
+	redFlash   map[string]bool         // mapped furnace's red light is flashing
+	lastStates map[uint16]bool         // state outputs as last written
+}
+
+func newPLCSink(c *config.Config, plc *plcIO, protocols []display.Protocol) *plcSink {
+	n := len(plc.furnaces)
+	s := &plcSink{
+		plc:        plc,
+		slots:      make(map[string]int, n),
+		protocols:  make([]display.Protocol, n),
+		boards:     make([]uint8, n),
+		slotBytes:  plc.conf.DisplaySlotBytes,
+		lightSlots: make(map[string]int, n),
+		mapped:     make(map[string]*config.Furnace),
+		display:    make([]byte, n*plc.conf.DisplaySlotBytes),
+		nonces:     make([]uint8, n),
+		states:     make(map[string]furnaceState),
+		redFlash:   make(map[string]bool),
+		lastStates: make(map[uint16]bool),
+	}
+
+	var addrs []uint16
+	for slot, i := range plc.furnaces {
+		f := &c.Furnaces[i]
+		s.slots[f.Name] = slot
+		s.protocols[slot] = protocols[i]
+		s.boards[slot] = f.DisplayBoardAddress
+
+		if len(f.StateOutputs) == 0 {
+			s.lightSlots[f.Name] = len(s.lightSlots)
+			continue
+		}
+
+		s.mapped[f.Name] = f
+		for _, out := range f.StateOutputs {
+			addrs = append(addrs, out.On...)
+			addrs = append(addrs, out.Flash...)
+		}
+	}
+
+	s.lights = make([]lightPattern, len(s.lightSlots)*coilsPerFurnace)
+
+	slices.Sort(addrs)
+	for _, addr := range slices.Compact(addrs) {
+		if last := len(s.stateRuns) - 1; last >= 0 && s.stateRuns[last][len(s.stateRuns[last])-1] == addr-1 {
+			s.stateRuns[last] = append(s.stateRuns[last], addr)
+		} else {
+			s.stateRuns = append(s.stateRuns, []uint16{addr})
+		}
+	}
+
+	return s
+}
+
+func (s *plcSink) Name() string {
+	return "delta PLC " + s.plc.conf.Name
+}
+
+func (s *plcSink) SetFurnaceState(furnace string, state furnaceState, lights []lightPattern, flashOn bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.mapped[furnace]; ok {
+		s.flashOn = flashOn
+		s.states[furnace] = state
+		s.redFlash[furnace] = lights[coilRed] == patternFlash
+		return
+	}
+
+	slot, ok := s.lightSlots[furnace]
+	if !ok {
+		return // on another PLC
+	}
+
+	copy(s.lights[slot*coilsPerFurnace:(slot+1)*coilsPerFurnace], lights)
+	s.flashOn = flashOn
+}
+
+// values of state outputs. outputs shared by furnaces are on if on for any. must hold lock
+func (s *plcSink) stateOutputs() map[uint16]bool {
+	values := make(map[uint16]bool)
+	for name, f := range s.mapped {
+		state, ok := s.states[name]
+		if !ok {
+			continue
+		}
+
+		out := f.StateOutputs[state.String()]
+		for _, addr := range out.On {
+			values[addr] = true
+		}
+
+		// alarm flashes as red light would, so acknowledge holds it steady
+		flashOn := s.flashOn || (state == stateAlarm && !s.redFlash[name])
+		for _, addr := range out.Flash {
+			values[addr] = values[addr] || flashOn
+		}
+	}
+	return values
+}
+
+// frame text for furnace's display board into its slot. empty text clears slot
+func (s *plcSink) ShowText(furnace, text string) {
+	slot, ok := s.slots[furnace]
+	if !ok {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	dst := s.display[slot*s.slotBytes : (slot+1)*s.slotBytes]
+	clear(dst)
+	s.textShown = true
+
+	if text == "" {
+		return
+	}
+
+	msg := []byte(text)
+	p := s.protocols[slot]
+	if maxLen := maxDisplayMsgLen(p, len(dst)); len(msg) > maxLen {
+		msg = msg[:maxLen]
+	}
+
+	makeDisplayStringRaw(p, s.boards[slot], s.nonces[slot], dst[:0], msg)
+	s.nonces[slot]++
+}
+
+// write coils if changed, and display slots if text was shown since last flush.
+// outputs are only marked as sent once written, so a write dropped while the PLC is down is retried
+func (s *plcSink) Flush(refresh bool) error {
+	s.lock.Lock()
+	coils := make([]bool, len(s.lights))
+	renderLights(coils, s.lights, s.flashOn)
+	resend := refresh || !s.lightsSent
+	writeCoils := resend || !slices.Equal(coils, s.lastCoils)
+
+	// runs of state outputs with a changed value
+	values := s.stateOutputs()
+	var runs [][]bool
+	var runAddrs []uint16
+	for _, run := range s.stateRuns {
+		changed := resend
+		vals := make([]bool, len(run))
+		for i, addr := range run {
+			vals[i] = values[addr]
+			if last, ok := s.lastStates[addr]; !ok || last != vals[i] {
+				changed = true
+			}
+		}
+		if changed {
+			runs = append(runs, vals)
+			runAddrs = append(runAddrs, run[0])
+		}
+	}
+
+	var display []byte
+	if s.textShown {
+		display = slices.Clone(s.display)
+		s.textShown = false
+	}
+	s.lock.Unlock()
+
+	// outside lock, as modbus requests block
+	var errs []error
+	coilsWritten := false
+	if writeCoils && len(coils) > 0 {
+		err := s.plc.writeOutputs(s.plc.conf.ModbusAddrLights, coils)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("light outputs: %w", err))
+		}
+		coilsWritten = s.plc.wrote(err)
+	}
+	runsWritten := make([]bool, len(runs))
+	for i, vals := range runs {
+		err := s.plc.writeOutputs(runAddrs[i], vals)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("state outputs at %d: %w", runAddrs[i], err))
+		}
+		runsWritten[i] = s.plc.wrote(err)
+	}
+	displayWritten := true
+	if display != nil {
+		err := s.plc.modbus.WriteBytes(s.plc.conf.ModbusAddrDisplays, display)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("display output data: %w", err))
+		}
+		displayWritten = s.plc.wrote(err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sent := coilsWritten || !writeCoils || len(coils) == 0
+	if coilsWritten {
+		s.lastCoils = coils
+	}
+	for i, vals := range runs {
+		if !runsWritten[i] {
+			sent = false
+			continue
+		}
+		for j, v := range vals {
+			s.lastStates[runAddrs[i]+uint16(j)] = v
+		}
+	}
+	if sent {
+		s.lightsSent = true
+	}
+	if !displayWritten {
+		s.textShown = true // resend with next flush
+	}
+
+	return errors.Join(errs...)
+}
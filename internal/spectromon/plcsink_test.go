@@ -0,0 +1,105 @@
+package spectromon
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/deltaplc"
+	"github.com/RoanBrand/SpectroMonitor/internal/display"
+	"github.com/RoanBrand/SpectroMonitor/internal/sim"
+)
+
+const testAlarmCoil = 20
+
+// sink of HF1 and HF2 light blocks, and HF3 with alarm state output, on a simulated PLC
+func newTestPLCSink(t *testing.T) (*plcSink, *sim.PLC) {
+	t.Helper()
+
+	plc, err := sim.NewPLC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { plc.Close() })
+
+	results := sim.NewResultServer()
+	t.Cleanup(results.Close)
+
+	conf := testConfig(plc, results)
+	hf3 := conf["furnaces"].([]any)[2].(map[string]any)
+	hf3["state_outputs"] = map[string]any{"alarm": map[string]any{"on": []int{testAlarmCoil}}}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, conf)
+	c, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc := &c.PLCs[0]
+	m, err := deltaplc.New(pc.Name, pc.ModbusURL, deltaplc.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+
+	protocols := make([]display.Protocol, len(c.Furnaces))
+	for i := range protocols {
+		protocols[i] = display.Standard{}
+	}
+
+	return newPLCSink(c, &plcIO{conf: pc, modbus: m, furnaces: c.FurnacesOn(pc.Name)}, protocols), plc
+}
+
+// outputs that failed to write are written on next flush, even if unchanged since
+func TestPLCSinkRetriesFailedWrites(t *testing.T) {
+	s, plc := newTestPLCSink(t)
+
+	green := []lightPattern{patternOff, patternOn, patternOff}
+	red := []lightPattern{patternOn, patternOff, patternOff}
+
+	s.SetFurnaceState("HF1", stateOK, green, true)
+	s.SetFurnaceState("HF3", stateOK, green, true)
+	if err := s.Flush(false); err != nil {
+		t.Fatal(err)
+	}
+	if got := plc.Coils(0, 3); !slices.Equal(got, []bool{false, true, false}) {
+		t.Fatalf("got HF1 lights %v, want green", got)
+	}
+
+	plc.SetDown(true)
+	s.SetFurnaceState("HF1", stateAlarm, red, true)
+	s.SetFurnaceState("HF3", stateAlarm, red, true)
+	if err := s.Flush(false); err == nil {
+		t.Fatal("no error while PLC is down")
+	}
+
+	// redialled in background, dropping writes until connected
+	plc.SetDown(false)
+	waitFor(t, "PLC reconnect", func() bool {
+		if err := s.Flush(false); err != nil {
+			t.Fatal(err)
+		}
+		return s.plc.modbus.Connected()
+	})
+	if err := s.Flush(false); err != nil {
+		t.Fatal(err)
+	}
+	if got := plc.Coils(0, 3); !slices.Equal(got, []bool{true, false, false}) {
+		t.Errorf("got HF1 lights %v after PLC is back, want red", got)
+	}
+	if !plc.Coils(testAlarmCoil, 1)[0] {
+		t.Error("HF3 alarm output off after PLC is back")
+	}
+
+	// outputs written once are not written again while unchanged
+	n := len(plc.Writes())
+	if err := s.Flush(false); err != nil {
+		t.Fatal(err)
+	}
+	if w := plc.Writes(); len(w) != n {
+		t.Errorf("unchanged outputs written again: %+v", w[n:])
+	}
+}
@@ -0,0 +1,147 @@
+package spectromon
+
+import (
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+)
+
+// how often config file is checked for changes
+const configCheckInterval = 5 * time.Second
+
+// reload config when config file changes or on SIGHUP
+func (a *app) watchConfig() {
+	if a.confPath == "" {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	t := time.NewTimer(configCheckInterval)
+	lastMod := modTime(a.confPath)
+
+	for {
+		select {
+		case <-t.C:
+			// a half written file fails to load, and is loaded again on next write
+			if mod := modTime(a.confPath); !mod.Equal(lastMod) {
+				lastMod = mod
+				a.reloadConfig("config file changed")
+			}
+			t.Reset(configCheckInterval)
+
+		case <-hup:
+			lastMod = modTime(a.confPath)
+			a.reloadConfig("SIGHUP")
+
+		case <-a.ctx.Done():
+			if !t.Stop() {
+				<-t.C
+			}
+			return
+		}
+	}
+}
+
+// zero if file is missing
+func modTime(filePath string) time.Time {
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// load and validate config file, then swap it in. current config is kept if invalid
+func (a *app) reloadConfig(reason string) {
+	log.Printf("reloading config '%s': %s", a.confPath, reason)
+
+	c, err := config.LoadConfig(a.confPath)
+	if err != nil {
+		log.Println("config reload failed, keeping current config:", err)
+		return
+	}
+
+	protocols, err := displayProtocols(c)
+	if err != nil {
+		log.Println("config reload failed, keeping current config:", err)
+		return
+	}
+
+	cal := loadCalendar(c)
+
+	_, current := a.configAndPLCs()
+	plcs, unused, err := connectPLCs(c, current)
+	if err != nil {
+		log.Println("config reload failed, keeping current config:", err)
+		return
+	}
+
+	a.lock.Lock()
+	old := a.conf
+	a.conf = c
+	a.plcs = plcs
+	a.sinks = newSinks(c, plcs, protocols)
+	a.calendar = cal
+
+	for name := range a.plcHeartbeatLost {
+		if !slices.ContainsFunc(plcs, func(p *plcIO) bool { return p.conf.Name == name }) {
+			delete(a.plcHeartbeatLost, name)
+		}
+	}
+
+	// furnace lights are laid out by position in furnace list
+	a.lights = make([]lightPattern, len(c.Furnaces)*coilsPerFurnace)
+	a.updateLights(time.Now())
+	if a.commsLost {
+		a.setCommsLostLights()
+	}
+	a.lock.Unlock()
+
+	for _, m := range unused {
+		log.Println("closing connection to removed Delta PLC", m.Name())
+		m.Close()
+	}
+
+	for _, key := range restartRequired(old, c) {
+		log.Printf("config reloaded, but change of %s only takes effect after restart", key)
+	}
+
+	log.Printf("config reloaded with %d furnaces: %v", len(c.Furnaces), furnaceNames(c))
+}
+
+// config keys that changed and are only read on startup
+func restartRequired(old, c *config.Config) []string {
+	var keys []string
+	if old.StatusHTTPAddr != c.StatusHTTPAddr {
+		keys = append(keys, "status_http_addr")
+	}
+	if old.ModbusServerURL != c.ModbusServerURL {
+		keys = append(keys, "modbus_server_url")
+	}
+	if old.MQTT != c.MQTT {
+		keys = append(keys, "mqtt")
+	}
+	if old.LogFilePath != c.LogFilePath {
+		keys = append(keys, "log_file_path")
+	}
+	if old.ResultStreamUrl != c.ResultStreamUrl {
+		keys = append(keys, "result_stream_url")
+	}
+	return keys
+}
+
+func furnaceNames(c *config.Config) []string {
+	names := make([]string, len(c.Furnaces))
+	for i := range c.Furnaces {
+		names[i] = c.Furnaces[i].Name
+	}
+	return names
+}
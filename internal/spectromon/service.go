@@ -3,32 +3,81 @@ package spectromon
 import (
 	"context"
 	"fmt"
-	"os/exec"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/RoanBrand/SpectroMonitor/internal/calendar"
 	"github.com/RoanBrand/SpectroMonitor/internal/config"
-	"github.com/RoanBrand/SpectroMonitor/internal/deltaplc"
 	"github.com/RoanBrand/SpectroMonitor/internal/http"
 	"github.com/RoanBrand/SpectroMonitor/internal/log"
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
 
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/kardianos/service"
+	"github.com/simonvetter/modbus"
+)
+
+// coil layout of each furnace's block of lights
+const (
+	coilRed = iota
+	coilGreen
+	coilAmber
+
+	coilsPerFurnace
 )
 
 type app struct {
-	conf       *config.Config
-	deltaPLCIO *deltaplc.Modbus
+	conf     *config.Config // swapped on reload, see config()
+	confPath string
+	plcs     []*plcIO
+	sinks    []outputSink // lights and display text, including PLCs
+	calendar *calendar.Calendar
 
 	ctx        context.Context
 	cancelFunc context.CancelFunc
 
-	furnaceLastResult map[string]time.Duration
+	furnaceLastResult map[string]furnaceResult
+	furnaceDown       map[string]bool
+	furnaceAckUntil   map[string]time.Time // flashing alarm held steady until
+	furnaceStates     map[string]furnaceState
+	displayText       map[string]string // last text sent to sinks
+	lights            []lightPattern    // per coil
+	lightsDirty       bool
+	plcHeartbeatLost  map[string]bool // per PLC
+	lastResultFetch   time.Time
+	lastResultErr     error
+	failedPolls       int // consecutive
+	commsLost         bool
+	resultStreamUp    bool
+	lastTimeSync      time.Time
+	clockOffset       time.Duration // result server's clock minus ours
+	clockOffsetSynced bool          // offset from time_update_url, more precise than Date header
 	lock              sync.Mutex
+
+	status       statusServer
+	modbusServer *modbus.ModbusServer
+	mqtt         mqtt.Client
+	mqttSite     string        // of client, as site change only takes effect after restart
+	hornDone     chan struct{} // closed once horns are cleared on stop
+}
+
+func New(c *config.Config, confPath string) *app {
+	return &app{conf: c, confPath: confPath}
+}
+
+// current config. loops take it once per iteration, as it can be swapped by reload
+func (a *app) config() *config.Config {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.conf
 }
 
-func New(c *config.Config) *app {
-	return &app{conf: c}
+// current config and PLC connections, which are swapped together on reload
+func (a *app) configAndPLCs() (*config.Config, []*plcIO) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.conf, a.plcs
 }
 
 func (a *app) Start(s service.Service) error {
@@ -40,28 +89,50 @@ func (a *app) Start(s service.Service) error {
 func (a *app) startup() {
 	log.Setup(a.conf.LogFilePath, !service.Interactive())
 
-	d, err := deltaplc.New(a.conf.ModbusURL)
-	if err != nil {
+	var err error
+	if a.plcs, _, err = connectPLCs(a.conf, nil); err != nil {
 		log.Fatal(err)
 	}
 
-	a.deltaPLCIO = d
-	a.furnaceLastResult = make(map[string]time.Duration)
-	url := a.makeURL()
-
-	a.doTask(url)
-
-	go a.runGetSetTimeJob()
+	protocols, err := displayProtocols(a.conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	a.sinks = newSinks(a.conf, a.plcs, protocols)
+	a.calendar = loadCalendar(a.conf)
+	a.furnaceLastResult = make(map[string]furnaceResult)
+	a.furnaceDown = make(map[string]bool)
+	a.furnaceAckUntil = make(map[string]time.Time)
+	a.furnaceStates = make(map[string]furnaceState)
+	a.displayText = make(map[string]string)
+	a.plcHeartbeatLost = make(map[string]bool)
+	a.lights = make([]lightPattern, len(a.conf.Furnaces)*coilsPerFurnace)
+	a.registerMetrics()
+
+	a.doTask()
+
+	go a.runTimeSyncJob()
+	go a.handleLights()
+	go a.handleAckButtons()
+	go a.handleHeartbeat()
 	go a.handleDisplayBoards()
+	a.lock.Lock()
+	a.hornDone = make(chan struct{})
+	a.lock.Unlock()
+	go a.handleHorn()
+	go a.runStatusServer()
+	a.startModbusServer()
+	go a.runResultStream()
+	go a.handleMQTT()
+	go a.watchConfig()
 
-	interval := time.Duration(a.conf.RequestIntervalSeconds) * time.Second
-	t := time.NewTimer(interval)
+	t := time.NewTimer(a.requestInterval())
 
 	for {
 		select {
 		case <-t.C:
-			a.doTask(url)
-			t.Reset(interval)
+			a.doTask()
+			t.Reset(a.requestInterval())
 		case <-a.ctx.Done():
 			if !t.Stop() {
 				<-t.C
@@ -71,89 +142,76 @@ func (a *app) startup() {
 	}
 }
 
-func (a *app) Stop(s service.Service) error {
-	a.cancelFunc()
-	return a.deltaPLCIO.Close()
+func (a *app) requestInterval() time.Duration {
+	return time.Duration(a.config().RequestIntervalSeconds) * time.Second
 }
 
-func (a *app) runGetSetTimeJob() {
-	if a.conf.TimeUpdateIntervalSeconds == 0 {
-		return
+func (a *app) Stop(s service.Service) error {
+	a.cancelFunc()
+	if err := a.stopStatusServer(); err != nil {
+		log.Println("failed to stop status http server:", err)
+	}
+	if err := a.stopModbusServer(); err != nil {
+		log.Println("failed to stop modbus server:", err)
 	}
+	a.stopMQTT()
 
-	interval := time.Duration(a.conf.TimeUpdateIntervalSeconds) * time.Second
-	t := time.NewTimer(interval)
+	a.lock.Lock()
+	hornDone := a.hornDone
+	a.lock.Unlock()
+	if hornDone != nil {
+		<-hornDone // horns cleared before PLCs are closed
+	}
 
-	for {
-		select {
-		case <-t.C:
-			newTime, err := http.GetTime(a.conf.TimeUpdateUrl)
-			if err != nil {
-				log.Println("unable to get time from network:", err)
-			} else {
-				if err = setSystemDate(newTime); err != nil {
-					log.Println("unable to update system time:", err)
-				}
-			}
+	a.lock.Lock()
+	plcs := a.plcs
+	a.lock.Unlock()
 
-			t.Reset(interval)
-		case <-a.ctx.Done():
-			if !t.Stop() {
-				<-t.C
-			}
-			return
+	var err error
+	for _, p := range plcs {
+		if cErr := p.modbus.Close(); cErr != nil {
+			err = cErr
 		}
 	}
+	return err
 }
 
 func (a *app) handleDisplayBoards() {
-	interval := time.Duration(a.conf.DisplayBoardUpdateRateSeconds) * time.Second
-	if interval == 0 {
-		interval = 1
-	}
-
-	t := time.NewTimer(interval)
-	maxAge := time.Duration(a.conf.FurnaceResultOldTimeMinutes) * time.Minute
+	t := time.NewTimer(displayUpdateInterval(a.config()))
 	colon := true
-
-	displayData := make([]byte, len(a.conf.Furnaces)*16)
-	nonces := make([]uint8, len(a.conf.Furnaces))
+	start := time.Now()
 
 	for {
 		select {
 		case <-t.C:
 			a.lock.Lock()
-			for i := range a.conf.Furnaces {
-				f := &a.conf.Furnaces[i]
-
-				d, ok := a.furnaceLastResult[f.Name]
-				if !ok {
-					continue
-				}
+			conf, sinks := a.conf, a.sinks
+			now := time.Now()
 
-				if d > maxAge {
-					d = maxAge
-				}
-
-				msg := []byte(formatDuration(d, colon))
-				addrOffSet := uint16(i * 16)
-				makeDisplayStringRaw(
-					f.DisplayBoardAddress,
-					nonces[i],
-					displayData[addrOffSet:addrOffSet],
-					msg)
+			pageInterval := time.Duration(conf.DisplayPageSeconds) * time.Second
+			if pageInterval == 0 {
+				pageInterval = 5 * time.Second
+			}
+			page := int(now.Sub(start) / pageInterval)
 
-				nonces[i]++
+			texts := make([]string, len(conf.Furnaces))
+			for i := range conf.Furnaces {
+				texts[i] = a.furnaceDisplayText(conf, i, page, colon, now)
+				a.displayText[conf.Furnaces[i].Name] = texts[i]
 			}
 			a.lock.Unlock()
 
-			err := a.deltaPLCIO.WriteBytes(a.conf.ModbusAddrDisplays, displayData)
-			if err != nil {
-				log.Println("failed to write display output data on delta PLC IO over Modbus:", err)
+			for _, s := range sinks {
+				for i := range conf.Furnaces {
+					s.ShowText(conf.Furnaces[i].Name, texts[i])
+				}
+				if err := s.Flush(false); err != nil {
+					log.Printf("failed to update display boards on %s: %v", s.Name(), err)
+				}
 			}
 
 			colon = !colon
-			t.Reset(interval)
+			t.Reset(displayUpdateInterval(conf))
 
 		case <-a.ctx.Done():
 			if !t.Stop() {
@@ -164,86 +222,176 @@ func (a *app) handleDisplayBoards() {
 	}
 }
 
+// current display page text of furnace i. empty if no result yet. must hold lock
+func (a *app) furnaceDisplayText(conf *config.Config, i int, page int, colon bool, now time.Time) string {
+	f := &conf.Furnaces[i]
+
+	if _, down := a.calendar.Down(f.Name, now); down {
+		return conf.DowntimeDisplayText
+	}
+	if a.commsLost {
+		return conf.CommsLostDisplayText
+	}
+
+	r, ok := a.furnaceLastResult[f.Name]
+	if !ok {
+		return ""
+	}
+	return string(displayPage(f, &r, a.sampleAge(&r, now), f.DisplayPages[page%len(f.DisplayPages)], colon))
+}
+
+func displayUpdateInterval(c *config.Config) time.Duration {
+	if c.DisplayBoardUpdateRateSeconds == 0 {
+		return time.Second
+	}
+	return time.Duration(c.DisplayBoardUpdateRateSeconds) * time.Second
+}
+
 // get latest test samples for furnaces and update lights
-func (a *app) doTask(url string) {
-	res, err := http.GetResult(url, a.conf)
+func (a *app) doTask() {
+	a.lock.Lock()
+	if a.resultStreamUp {
+		// results are pushed, only age lights
+		a.updateLights(time.Now())
+		a.lock.Unlock()
+		return
+	}
+	conf := a.conf
+	a.lock.Unlock()
+
+	start := time.Now()
+	res, serverTime, err := http.GetResult(makeURL(conf), conf)
+	received := time.Now()
+	observeResultFetch(start, err)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if err == nil && !a.clockOffsetSynced {
+		// Date header has second resolution
+		a.updateClockOffset(serverTime, start, received, time.Second)
+	}
+
+	a.lastResultErr = err
 	if err != nil {
 		log.Println(err)
+
+		a.failedPolls++
+		if !a.commsLost && conf.CommsLostAfterFailedPolls > 0 && a.failedPolls >= conf.CommsLostAfterFailedPolls {
+			log.Printf("communications to result server lost after %d failed polls", a.failedPolls)
+			a.commsLost = true
+			a.setCommsLostLights()
+		}
 		return
 	}
 
-	maxAge := time.Duration(a.conf.FurnaceResultOldTimeMinutes) * time.Minute
+	if a.commsLost {
+		log.Printf("communications to result server restored after %d failed polls", a.failedPolls)
+		a.commsLost = false
+	}
+	a.failedPolls = 0
 
-	coils := make([]bool, len(a.conf.Furnaces)*2)
+	a.lastResultFetch = time.Now()
+	a.storeResults(res)
+	a.updateLights(time.Now())
+}
 
-	a.lock.Lock()
+// keep latest result per furnace. must hold lock
+func (a *app) storeResults(res []model.Result) {
+	for i := range res {
+		resF := &res[i]
 
-	now := time.Now()
-	for i := range a.conf.Furnaces {
-		f := &a.conf.Furnaces[i]
-		addrOffSet := uint16(i * 2)
+		if last, ok := a.furnaceLastResult[resF.Furnace]; ok && resF.TimeStamp.Before(last.timeStamp) {
+			continue
+		}
 
-		for j := range res {
-			resF := &res[j]
+		a.furnaceLastResult[resF.Furnace] = furnaceResult{
+			timeStamp:  resF.TimeStamp,
+			sampleName: resF.SampleName,
+			results:    resF.Results,
+		}
+	}
+}
 
-			if resF.Furnace != f.Name {
-				continue
-			}
+// set furnace lights from age of latest results. must hold lock
+func (a *app) updateLights(now time.Time) {
+	for i := range a.conf.Furnaces {
+		f := &a.conf.Furnaces[i]
+		addrOffSet := i * coilsPerFurnace
+		lights := a.lights[addrOffSet : addrOffSet+coilsPerFurnace]
 
-			a.furnaceLastResult[f.Name] = now.Sub(resF.TimeStamp)
-			if a.furnaceLastResult[f.Name] > maxAge {
-				// red
-				coils[addrOffSet] = true
-				coils[addrOffSet+1] = false
+		w, down := a.calendar.Down(f.Name, now)
+		if down != a.furnaceDown[f.Name] {
+			if down {
+				log.Printf("furnace %s in planned downtime: %s", f.Name, w.Reason)
 			} else {
-				// green
-				coils[addrOffSet] = false
-				coils[addrOffSet+1] = true
+				log.Printf("furnace %s planned downtime ended", f.Name)
 			}
+			a.furnaceDown[f.Name] = down
+		}
 
-			break
+		clear(lights)
+		if down {
+			a.furnaceStates[f.Name] = stateDowntime
+			continue
+		}
+
+		r, ok := a.furnaceLastResult[f.Name]
+		if !ok {
+			a.furnaceStates[f.Name] = stateNoResult
+			continue
 		}
-	}
-	a.lock.Unlock()
 
-	if err = a.deltaPLCIO.WriteCoils(a.conf.ModbusAddrLights, coils); err != nil {
-		log.Println("failed to set output coils for light on delta PLC IO over Modbus:", err)
+		age := a.sampleAge(&r, now)
+
+		switch {
+		case f.AlarmFlashAfterMinutes > 0 && age > f.AlarmAge()+f.AlarmFlashAfter():
+			lights[coilRed] = patternFlash // steady while acknowledged, see shownLights
+			a.furnaceStates[f.Name] = stateAlarm
+		case age > f.AlarmAge():
+			lights[coilRed] = patternOn
+			a.furnaceStates[f.Name] = stateAlarm
+		case age > f.WarningAge():
+			lights[coilAmber] = patternOn
+			a.furnaceStates[f.Name] = stateWarning
+		default:
+			lights[coilGreen] = patternOn
+			a.furnaceStates[f.Name] = stateOK
+		}
 	}
+
+	a.lightsDirty = true
 }
 
-func (a *app) makeURL() string {
-	url := strings.TrimSuffix(a.conf.ResultUrl, "/")
-	url += "?"
+// flash amber on all furnaces not in downtime. must hold lock
+func (a *app) setCommsLostLights() {
 	for i := range a.conf.Furnaces {
-		url += "f=" + a.conf.Furnaces[i].Name + "&"
-	}
+		f := &a.conf.Furnaces[i]
+		if a.furnaceDown[f.Name] {
+			continue
+		}
 
-	if a.conf.TransferSamplesOnly {
-		url += "t=true"
+		lights := a.lights[i*coilsPerFurnace : (i+1)*coilsPerFurnace]
+		clear(lights)
+		lights[coilAmber] = patternFlash
+		a.furnaceStates[f.Name] = stateCommsLost
 	}
 
-	return url
+	a.lightsDirty = true
 }
 
-// whole msg must fit in dst's cap
-func makeDisplayStringRaw(displayAddress, nonce uint8, dst, msg []byte) {
-	//b := make([]byte, 0, 16)
-	dst = append(dst, 0x0, 0x53, displayAddress, 0x3)
-
-	dst = append(dst, msg...)
-	dst = append(dst, 0x4)
-
-	var newXor byte
-	for _, dataByte := range dst {
-		newXor ^= dataByte
+func makeURL(c *config.Config) string {
+	url := strings.TrimSuffix(c.ResultUrl, "/")
+	url += "?"
+	for i := range c.Furnaces {
+		url += "f=" + c.Furnaces[i].Name + "&"
 	}
-	dst = append(dst, newXor)
 
-	// nonce byte is last byte written to plc that changes with each new message
-	// so that plc can know when to read a new value
-	dst = append(dst, nonce)
+	if c.TransferSamplesOnly {
+		url += "t=true"
+	}
 
-	//return b
+	return url
 }
 
 func formatDuration(d time.Duration, withColon bool) string {
@@ -258,16 +406,3 @@ func formatDuration(d time.Duration, withColon bool) string {
 		return fmt.Sprintf("%02d %02d", h, m)
 	}
 }
-
-func setSystemDate(newTime time.Time) error {
-	_, err := exec.LookPath("date")
-	if err != nil {
-		log.Printf("Date binary not found, cannot set system date: %s\n", err.Error())
-		return err
-	}
-
-	dateString := newTime.Format("2 Jan 2006 15:04:05")
-	log.Printf("Setting system date to: %s\n", dateString)
-	args := []string{"--set", dateString}
-	return exec.Command("date", args...).Run()
-}
@@ -0,0 +1,206 @@
+package spectromon
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/display"
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
+	"github.com/RoanBrand/SpectroMonitor/internal/sim"
+)
+
+const (
+	testCommsFaultCoil = 50
+	testSlotBytes      = 16
+)
+
+// config of furnaces HF1, HF2 and HF3 on plc, polling results
+func testConfig(plc *sim.PLC, results *sim.ResultServer) map[string]any {
+	furnaces := []string{"HF1", "HF2", "HF3"}
+
+	fs := make([]any, len(furnaces))
+	for i, name := range furnaces {
+		fs[i] = map[string]any{
+			"name":                  name,
+			"display_board_address": i + 1,
+			"display_pages":         []string{"time"},
+			"warning_age_minutes":   30,
+			"alarm_age_minutes":     60,
+		}
+	}
+
+	return map[string]any{
+		"modbus_url":                      plc.URL,
+		"modbus_address_start_lights":     0,
+		"modbus_address_start_displays":   0,
+		"modbus_address_comms_fault_coil": testCommsFaultCoil,
+		"result_url":                      results.ResultURL(),
+		"request_interval_seconds":        1,
+		"light_flash_interval_ms":         100,
+		"display_slot_bytes":              testSlotBytes,
+		"comms_lost_after_failed_polls":   1,
+		"time_sync_source":                "none",
+		"furnaces":                        fs,
+	}
+}
+
+func writeTestConfig(t *testing.T, path string, conf map[string]any) {
+	t.Helper()
+
+	data, err := json.Marshal(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// start spectromon on a simulated PLC, polling results. extra is added to testConfig.
+// stop can be called before the test ends
+func startTestApp(t *testing.T, results *sim.ResultServer, extra map[string]any) (a *app, plc *sim.PLC, stop func()) {
+	t.Helper()
+
+	plc, err := sim.NewPLC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { plc.Close() })
+
+	conf := testConfig(plc, results)
+	for k, v := range extra {
+		conf[k] = v
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, conf)
+
+	c, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a = New(c, path)
+	if err = a.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var once sync.Once
+	stop = func() { once.Do(func() { a.Stop(nil) }) }
+	t.Cleanup(stop)
+
+	return a, plc, stop
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// whether display slot of furnace shows text, with either phase of the blinking colon
+func showsText(plc *sim.PLC, slot int, boardAddr uint8, texts ...string) bool {
+	got := plc.Bytes(uint16(slot*testSlotBytes/2), testSlotBytes)
+	for _, text := range texts {
+		frame := display.Standard{}.Encode(nil, boardAddr, []byte(text))
+		if bytes.HasPrefix(got, frame) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLightsAndDisplays(t *testing.T) {
+	results := sim.NewResultServer()
+	defer results.Close()
+
+	now := time.Now()
+	results.SetResults(
+		model.Result{Furnace: "HF1", SampleName: "S1", TimeStamp: now.Add(-10 * time.Minute)},
+		model.Result{Furnace: "HF2", SampleName: "S2", TimeStamp: now.Add(-45 * time.Minute)},
+		model.Result{Furnace: "HF3", SampleName: "S3", TimeStamp: now.Add(-90 * time.Minute)},
+	)
+
+	_, plc, _ := startTestApp(t, results, nil)
+
+	// red, green, amber per furnace
+	want := []bool{
+		false, true, false,
+		false, false, true,
+		true, false, false,
+	}
+	waitFor(t, "lights", func() bool { return slices.Equal(plc.Coils(0, 9), want) })
+
+	// age is capped at alarm age
+	waitFor(t, "display boards", func() bool {
+		return showsText(plc, 0, 1, "00:10", "00 10") &&
+			showsText(plc, 1, 2, "00:45", "00 45") &&
+			showsText(plc, 2, 3, "01:00", "01 00")
+	})
+
+	if plc.Coils(testCommsFaultCoil, 1)[0] {
+		t.Error("comms fault coil on while result server is up")
+	}
+}
+
+func TestCommsLost(t *testing.T) {
+	results := sim.NewResultServer()
+	defer results.Close()
+
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S1", TimeStamp: time.Now().Add(-10 * time.Minute)})
+
+	_, plc, _ := startTestApp(t, results, nil)
+	waitFor(t, "green light", func() bool { return plc.Coils(0, 3)[1] })
+
+	results.SetDown(true)
+	waitFor(t, "comms fault coil", func() bool { return plc.Coils(testCommsFaultCoil, 1)[0] })
+
+	// amber flashes on every furnace, other lights off
+	for slot := 0; slot < 3; slot++ {
+		addr := uint16(slot * coilsPerFurnace)
+		waitFor(t, "amber on", func() bool { return slices.Equal(plc.Coils(addr, 3), []bool{false, false, true}) })
+		waitFor(t, "amber off", func() bool { return slices.Equal(plc.Coils(addr, 3), []bool{false, false, false}) })
+	}
+
+	waitFor(t, "comms lost text", func() bool {
+		return showsText(plc, 0, 1, "--:--") && showsText(plc, 1, 2, "--:--") && showsText(plc, 2, 3, "--:--")
+	})
+
+	results.SetDown(false)
+	waitFor(t, "comms fault cleared", func() bool { return !plc.Coils(testCommsFaultCoil, 1)[0] })
+	waitFor(t, "green light", func() bool { return slices.Equal(plc.Coils(0, 3), []bool{false, true, false}) })
+}
+
+// comms fault raised while PLC is unreachable is written once it is back
+func TestCommsFaultWrittenAfterPLCReconnect(t *testing.T) {
+	results := sim.NewResultServer()
+	defer results.Close()
+
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S1", TimeStamp: time.Now().Add(-10 * time.Minute)})
+
+	a, plc, _ := startTestApp(t, results, nil)
+	waitFor(t, "green light", func() bool { return plc.Coils(0, 3)[1] })
+
+	plc.Close()
+	results.SetDown(true)
+	waitFor(t, "comms lost", func() bool { return a.getStatus().CommsLost })
+	time.Sleep(300 * time.Millisecond) // a few flashes with PLC down
+
+	if err := plc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "comms fault coil", func() bool { return plc.Coils(testCommsFaultCoil, 1)[0] })
+}
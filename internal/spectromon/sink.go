@@ -0,0 +1,99 @@
+package spectromon
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/display"
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+)
+
+// outputSink shows furnace state on andon hardware, e.g. lights and display boards on a PLC.
+// Every flash interval each furnace's state is set, and every display update its text is shown,
+// followed by a Flush that sends what changed. Calls can come from different goroutines.
+type outputSink interface {
+	Name() string // for logs
+
+	// lights are patterns by coil, flashOn is the current phase of flashing lights
+	SetFurnaceState(furnace string, state furnaceState, lights []lightPattern, flashOn bool)
+	ShowText(furnace, text string)
+
+	// with refresh, everything is resent even if unchanged
+	Flush(refresh bool) error
+}
+
+// sinks in config, PLC sinks writing to plcs
+func newSinks(c *config.Config, plcs []*plcIO, protocols []display.Protocol) []outputSink {
+	var sinks []outputSink
+	for i := range c.OutputSinks {
+		sc := &c.OutputSinks[i]
+
+		switch sc.Type {
+		case config.SinkPLC:
+			for _, plc := range plcs {
+				sinks = append(sinks, newPLCSink(c, plc, protocols))
+			}
+		case config.SinkLog:
+			sinks = append(sinks, newLogSink())
+		case config.SinkWebhook:
+			sinks = append(sinks, newWebhookSink(sc))
+		}
+	}
+	return sinks
+}
+
+// lights of a furnace for status and webhooks, e.g. {"red": "flash", "green": "off", "amber": "off"}
+func lightNames(lights []lightPattern) map[string]string {
+	return map[string]string{
+		"red":   lights[coilRed].String(),
+		"green": lights[coilGreen].String(),
+		"amber": lights[coilAmber].String(),
+	}
+}
+
+// logs furnace state changes, with text shown at the time.
+// text alone is not logged, as time since sample changes every second
+type logSink struct {
+	lock    sync.Mutex
+	state   map[string]string // per furnace, as logged
+	text    map[string]string
+	changed []string // furnaces
+}
+
+func newLogSink() *logSink {
+	return &logSink{state: make(map[string]string), text: make(map[string]string)}
+}
+
+func (s *logSink) Name() string {
+	return "log"
+}
+
+func (s *logSink) SetFurnaceState(furnace string, state furnaceState, lights []lightPattern, _ bool) {
+	st := fmt.Sprintf("%s, lights red %s, green %s, amber %s", state, lights[coilRed], lights[coilGreen], lights[coilAmber])
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if st != s.state[furnace] {
+		s.state[furnace] = st
+		s.changed = append(s.changed, furnace)
+	}
+}
+
+func (s *logSink) ShowText(furnace, text string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.text[furnace] = text
+}
+
+func (s *logSink) Flush(bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, f := range s.changed {
+		log.Printf("furnace %s: %s, display %q", f, s.state[f], s.text[f])
+	}
+	s.changed = s.changed[:0]
+	return nil
+}
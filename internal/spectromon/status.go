@@ -0,0 +1,161 @@
+package spectromon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// local HTTP API for maintenance staff to inspect panel, and prometheus metrics
+type statusServer struct {
+	srv *http.Server
+}
+
+type furnaceStatus struct {
+	Name              string            `json:"name"`
+	PLC               string            `json:"plc"`
+	State             string            `json:"state"`
+	Lights            map[string]string `json:"lights"`
+	LastSampleName    string            `json:"last_sample_name,omitempty"`
+	LastSampleTime    *time.Time        `json:"last_sample_time,omitempty"`
+	AgeMinutes        *float64          `json:"age_minutes,omitempty"`
+	DisplayText       string            `json:"display_text"`
+	AcknowledgedUntil *time.Time        `json:"acknowledged_until,omitempty"`
+}
+
+type plcStatus struct {
+	Name          string `json:"name"`
+	URL           string `json:"url"`
+	Connected     bool   `json:"connected"`
+	InSync        bool   `json:"in_sync"`
+	HeartbeatLost bool   `json:"heartbeat_lost"`
+}
+
+type status struct {
+	Time                 time.Time       `json:"time"`
+	Furnaces             []furnaceStatus `json:"furnaces"`
+	PLCs                 []plcStatus     `json:"plcs"`
+	LastResultFetch      *time.Time      `json:"last_result_fetch,omitempty"`
+	LastResultFetchError string          `json:"last_result_fetch_error,omitempty"`
+	FailedPolls          int             `json:"failed_polls"`
+	ResultStreamUp       bool            `json:"result_stream_up"`
+	CommsLost            bool            `json:"comms_lost"`
+	LastTimeSync         *time.Time      `json:"last_time_sync,omitempty"`
+	ClockOffsetSeconds   float64         `json:"clock_offset_seconds"` // result server's clock minus ours
+}
+
+func (a *app) runStatusServer() {
+	addr := a.config().StatusHTTPAddr
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", a.statusEndpoint)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	a.lock.Lock()
+	a.status.srv = &http.Server{Addr: addr, Handler: mux}
+	srv := a.status.srv
+	a.lock.Unlock()
+
+	err := srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Println("status http server failed:", err)
+	}
+}
+
+func (a *app) stopStatusServer() error {
+	a.lock.Lock()
+	srv := a.status.srv
+	a.lock.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+func (a *app) statusEndpoint(w http.ResponseWriter, r *http.Request) {
+	st := a.getStatus()
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(&st)
+}
+
+func (a *app) getStatus() status {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	// connection state is read without waiting for modbus requests in progress
+	plcSt := make([]plcStatus, len(a.plcs))
+	for i, p := range a.plcs {
+		plcSt[i] = plcStatus{
+			Name:          p.conf.Name,
+			URL:           p.conf.ModbusURL,
+			Connected:     p.modbus.Connected(),
+			InSync:        p.modbus.InSync(),
+			HeartbeatLost: a.plcHeartbeatLost[p.conf.Name],
+		}
+	}
+
+	now := time.Now()
+	st := status{
+		Time:               now,
+		Furnaces:           make([]furnaceStatus, len(a.conf.Furnaces)),
+		PLCs:               plcSt,
+		LastResultFetch:    timeOrNil(a.lastResultFetch),
+		FailedPolls:        a.failedPolls,
+		ResultStreamUp:     a.resultStreamUp,
+		CommsLost:          a.commsLost,
+		LastTimeSync:       timeOrNil(a.lastTimeSync),
+		ClockOffsetSeconds: a.clockOffset.Seconds(),
+	}
+
+	if a.lastResultErr != nil {
+		st.LastResultFetchError = a.lastResultErr.Error()
+	}
+
+	for i := range a.conf.Furnaces {
+		f := &a.conf.Furnaces[i]
+		fs := &st.Furnaces[i]
+
+		fs.Name = f.Name
+		fs.PLC = f.PLC
+		fs.State = a.furnaceStates[f.Name].String()
+		fs.DisplayText = a.displayText[f.Name]
+
+		fs.Lights = lightNames(a.shownLights(i, now))
+
+		if r, ok := a.furnaceLastResult[f.Name]; ok {
+			fs.LastSampleName = r.sampleName
+			fs.LastSampleTime = &r.timeStamp
+			age := a.sampleAge(&r, now).Minutes()
+			fs.AgeMinutes = &age
+		}
+
+		if until := a.furnaceAckUntil[f.Name]; now.Before(until) {
+			fs.AcknowledgedUntil = &until
+		}
+	}
+
+	return st
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
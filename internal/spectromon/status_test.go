@@ -0,0 +1,32 @@
+package spectromon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
+	"github.com/RoanBrand/SpectroMonitor/internal/sim"
+)
+
+// status, as polled by SCADA and MQTT, does not wait on a PLC that stopped answering
+func TestStatusWithPLCHung(t *testing.T) {
+	results := sim.NewResultServer()
+	defer results.Close()
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S1", TimeStamp: time.Now().Add(-10 * time.Minute)})
+
+	a, plc, _ := startTestApp(t, results, nil)
+	waitFor(t, "green light", func() bool { return plc.Coils(0, 3)[1] })
+
+	plc.SetHung(true)
+	defer plc.SetHung(false)
+	time.Sleep(1500 * time.Millisecond) // display update stuck on PLC
+
+	start := time.Now()
+	st := a.getStatus()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("status took %s with PLC hung", d)
+	}
+	if len(st.PLCs) != 1 || st.PLCs[0].Name != "default" {
+		t.Errorf("got PLCs %+v, want default", st.PLCs)
+	}
+}
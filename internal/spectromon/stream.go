@@ -0,0 +1,83 @@
+package spectromon
+
+import (
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/http"
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
+)
+
+// subscribe to pushed results. doTask polls while stream is down
+func (a *app) runResultStream() {
+	conf := a.config()
+	url := conf.ResultStreamUrl
+	if url == "" {
+		return
+	}
+
+	// server sends keepalives when there are no new results
+	idleTimeout := 2 * time.Duration(conf.RequestIntervalSeconds) * time.Second
+
+	const maxRetryTime = time.Minute
+	retryTime := time.Second
+	var lastErr string // logged once, until stream is up
+
+	for {
+		err := http.SubscribeResults(a.ctx, url, idleTimeout, a.onResultStreamConnected, a.onPushedResults)
+
+		a.lock.Lock()
+		wasUp := a.resultStreamUp
+		a.resultStreamUp = false
+		a.lock.Unlock()
+
+		if a.ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case wasUp:
+			retryTime = time.Second
+			lastErr = err.Error()
+			log.Println("result stream dropped, falling back to polling:", err)
+		case err.Error() != lastErr:
+			lastErr = err.Error()
+			log.Printf("failed to subscribe to result stream at %s, polling instead: %v", url, err)
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-time.After(retryTime):
+		}
+
+		if retryTime *= 2; retryTime > maxRetryTime {
+			retryTime = maxRetryTime
+		}
+	}
+}
+
+func (a *app) onResultStreamConnected() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	log.Println("subscribed to result stream")
+	a.resultStreamUp = true
+
+	if a.commsLost {
+		log.Println("communications to result server restored")
+		a.commsLost = false
+		a.updateLights(time.Now())
+	}
+	a.failedPolls = 0
+}
+
+func (a *app) onPushedResults(res []model.Result) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := time.Now()
+	a.lastResultFetch = now
+	a.storeResults(res)
+	a.updateLights(now)
+}
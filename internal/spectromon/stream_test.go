@@ -0,0 +1,49 @@
+package spectromon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/model"
+	"github.com/RoanBrand/SpectroMonitor/internal/sim"
+)
+
+// pushed results replace polling, until stream drops or stalls
+func TestResultStream(t *testing.T) {
+	results := sim.NewResultServer()
+	defer results.Close()
+	results.SetResults(model.Result{Furnace: "HF1", SampleName: "S1", TimeStamp: time.Now().Add(-45 * time.Minute)})
+
+	a, plc, _ := startTestApp(t, results, map[string]any{"result_stream_url": results.StreamURL()})
+	streamUp := func() bool { return a.getStatus().ResultStreamUp }
+	waitFor(t, "amber light", func() bool { return plc.Coils(0, 3)[2] })
+	waitFor(t, "result stream", streamUp)
+
+	results.Publish(model.Result{Furnace: "HF1", SampleName: "S2", TimeStamp: time.Now().Add(-5 * time.Minute)})
+	waitFor(t, "green light", func() bool { return plc.Coils(0, 3)[1] })
+
+	// keepalives hold stream up for longer than idle timeout, without polling
+	polls := results.Requests()
+	time.Sleep(3 * time.Second)
+	if !streamUp() {
+		t.Fatal("result stream dropped while server sends keepalives")
+	}
+	if n := results.Requests(); n != polls {
+		t.Fatalf("polled %d times while result stream is up", n-polls)
+	}
+
+	// connection open, but nothing on it
+	results.StallStreams(true)
+	waitFor(t, "polling on stalled stream", func() bool { return results.Requests() > polls })
+	if a.getStatus().CommsLost {
+		t.Error("comms lost while polling works")
+	}
+
+	results.StallStreams(false)
+	waitFor(t, "result stream", streamUp)
+
+	results.CloseStreams()
+	waitFor(t, "result stream dropped", func() bool { return !streamUp() })
+	polls = results.Requests()
+	waitFor(t, "polling on dropped stream", func() bool { return results.Requests() > polls })
+}
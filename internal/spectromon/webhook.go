@@ -0,0 +1,154 @@
+package spectromon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+	"github.com/RoanBrand/SpectroMonitor/internal/log"
+)
+
+// furnace in JSON POSTed to webhook
+type webhookFurnace struct {
+	Name   string            `json:"name"`
+	State  string            `json:"state"`
+	Lights map[string]string `json:"lights"`
+	Text   string            `json:"text"`
+}
+
+// POSTs furnaces whose state or lights changed as {"furnaces": [...]} to a URL.
+// display text is sent along, but changing text alone does not post, as time since sample changes every second.
+// posts are made in the background, so a slow or down receiver does not hold up other sinks.
+// furnaces that change while a post is in flight are sent together in the next one.
+// furnaces in a failed post are sent again on next refresh
+type webhookSink struct {
+	url    string
+	client *http.Client
+
+	lock    sync.Mutex
+	current map[string]webhookFurnace // per furnace, as set
+	sent    map[string]webhookFurnace // as last flushed
+	pending map[string]webhookFurnace // flushed, not yet posted
+	posting bool
+	lastErr string // logged once, until a post succeeds
+}
+
+func newWebhookSink(sc *config.OutputSink) *webhookSink {
+	timeout := time.Duration(sc.TimeoutMs) * time.Millisecond
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &webhookSink{
+		url:     sc.URL,
+		client:  &http.Client{Timeout: timeout},
+		current: make(map[string]webhookFurnace),
+		sent:    make(map[string]webhookFurnace),
+		pending: make(map[string]webhookFurnace),
+	}
+}
+
+func (s *webhookSink) Name() string {
+	return "webhook " + s.url
+}
+
+func (s *webhookSink) SetFurnaceState(furnace string, state furnaceState, lights []lightPattern, _ bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f := s.current[furnace]
+	f.Name, f.State, f.Lights = furnace, state.String(), lightNames(lights)
+	s.current[furnace] = f
+}
+
+func (s *webhookSink) ShowText(furnace, text string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f := s.current[furnace]
+	f.Name, f.Text = furnace, text
+	s.current[furnace] = f
+}
+
+func (s *webhookSink) Flush(refresh bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for name, f := range s.current {
+		if f.Lights == nil {
+			continue // state not set yet
+		}
+		if last, ok := s.sent[name]; !refresh && ok && last.State == f.State && maps.Equal(last.Lights, f.Lights) {
+			continue
+		}
+		s.sent[name] = f
+		s.pending[name] = f
+	}
+
+	if len(s.pending) > 0 && !s.posting {
+		s.posting = true
+		go s.post()
+	}
+	return nil
+}
+
+// post pending furnaces until none are left
+func (s *webhookSink) post() {
+	for {
+		s.lock.Lock()
+		if len(s.pending) == 0 {
+			s.posting = false
+			s.lock.Unlock()
+			return
+		}
+
+		furnaces := make([]webhookFurnace, 0, len(s.pending))
+		for _, f := range s.pending {
+			furnaces = append(furnaces, f)
+		}
+		slices.SortFunc(furnaces, func(a, b webhookFurnace) int { return strings.Compare(a.Name, b.Name) })
+		clear(s.pending)
+		s.lock.Unlock()
+
+		err := s.send(furnaces)
+
+		s.lock.Lock()
+		if err != nil {
+			if err.Error() != s.lastErr {
+				s.lastErr = err.Error()
+				log.Printf("failed to post furnace state to webhook %s: %v", s.url, err)
+			}
+		} else if s.lastErr != "" {
+			s.lastErr = ""
+			log.Printf("posting furnace state to webhook %s restored", s.url)
+		}
+		s.lock.Unlock()
+	}
+}
+
+func (s *webhookSink) send(furnaces []webhookFurnace) error {
+	body, err := json.Marshal(struct {
+		Furnaces []webhookFurnace `json:"furnaces"`
+	}{furnaces})
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
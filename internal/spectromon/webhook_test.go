@@ -0,0 +1,93 @@
+package spectromon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/config"
+)
+
+// receives webhook posts
+type webhookReceiver struct {
+	*httptest.Server
+
+	lock  sync.Mutex
+	posts [][]webhookFurnace
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	r := &webhookReceiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Furnaces []webhookFurnace `json:"furnaces"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("decode post: %v", err)
+		}
+
+		r.lock.Lock()
+		r.posts = append(r.posts, body.Furnaces)
+		r.lock.Unlock()
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) Posts() [][]webhookFurnace {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([][]webhookFurnace(nil), r.posts...)
+}
+
+// flush and wait for post to finish
+func flushWebhook(t *testing.T, s *webhookSink, refresh bool) {
+	t.Helper()
+
+	if err := s.Flush(refresh); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "webhook post", func() bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return !s.posting
+	})
+}
+
+func TestWebhookPostsOnStateChange(t *testing.T) {
+	r := newWebhookReceiver(t)
+	s := newWebhookSink(&config.OutputSink{Type: config.SinkWebhook, URL: r.URL})
+
+	green := []lightPattern{patternOff, patternOn, patternOff}
+	s.SetFurnaceState("HF1", stateOK, green, false)
+	s.ShowText("HF1", "00:10")
+	flushWebhook(t, s, false)
+
+	// text changes every second, and is only sent along with state
+	s.ShowText("HF1", "00:11")
+	flushWebhook(t, s, false)
+	if n := len(r.Posts()); n != 1 {
+		t.Fatalf("got %d posts after text change, want 1", n)
+	}
+
+	amber := []lightPattern{patternOff, patternOff, patternOn}
+	s.SetFurnaceState("HF1", stateWarning, amber, false)
+	s.ShowText("HF1", "00:30")
+	flushWebhook(t, s, false)
+
+	posts := r.Posts()
+	if len(posts) != 2 {
+		t.Fatalf("got %d posts after state change, want 2", len(posts))
+	}
+	if f := posts[1]; len(f) != 1 || f[0].State != "warning" || f[0].Lights["amber"] != "on" || f[0].Text != "00:30" {
+		t.Errorf("got post %+v, want HF1 warning with amber on and text 00:30", f)
+	}
+
+	// refresh sends unchanged furnaces again
+	flushWebhook(t, s, true)
+	if n := len(r.Posts()); n != 3 {
+		t.Errorf("got %d posts after refresh, want 3", n)
+	}
+}
@@ -0,0 +1,12 @@
+package timesync
+
+import (
+	"syscall"
+	"time"
+)
+
+// SetSystemClock steps the system clock by offset. Needs CAP_SYS_TIME.
+func SetSystemClock(offset time.Duration) error {
+	tv := syscall.NsecToTimeval(time.Now().Add(offset).UnixNano())
+	return syscall.Settimeofday(&tv)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package timesync
+
+import (
+	"errors"
+	"runtime"
+	"time"
+)
+
+// SetSystemClock is only supported on linux.
+func SetSystemClock(offset time.Duration) error {
+	return errors.New("setting system clock not supported on " + runtime.GOOS)
+}
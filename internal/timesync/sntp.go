@@ -0,0 +1,93 @@
+package timesync
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// seconds from NTP epoch (1900) to Unix epoch (1970)
+const ntpEpochOffset = 2208988800
+
+// SNTP client (RFC 4330).
+type SNTP struct {
+	Server  string // host or host:port. port defaults to 123
+	Timeout time.Duration
+}
+
+func (s *SNTP) Offset(ctx context.Context) (time.Duration, error) {
+	addr := s.Server
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "123")
+	}
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	req := make([]byte, 48)
+	req[0] = 0<<6 | 4<<3 | 3 // no leap warning, version 4, client mode
+
+	t1 := time.Now()
+	putNTPTime(req[40:], t1)
+
+	if _, err = conn.Write(req); err != nil {
+		return 0, err
+	}
+
+	res := make([]byte, 48)
+	n, err := conn.Read(res)
+	t4 := time.Now()
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 48 {
+		return 0, errors.New("sntp: short response")
+	}
+	if mode := res[0] & 0x7; mode != 4 {
+		return 0, fmt.Errorf("sntp: unexpected mode %d in response", mode)
+	}
+	if res[1] == 0 {
+		return 0, fmt.Errorf("sntp: kiss-o'-death from server: %s", res[12:16])
+	}
+	if res[0]>>6 == 3 {
+		return 0, errors.New("sntp: server clock not synchronized")
+	}
+	if binary.BigEndian.Uint64(res[24:]) != binary.BigEndian.Uint64(req[40:]) {
+		return 0, errors.New("sntp: response does not match request")
+	}
+
+	t2 := ntpTime(res[32:])
+	t3 := ntpTime(res[40:])
+
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+func ntpTime(b []byte) time.Time {
+	sec := int64(binary.BigEndian.Uint32(b)) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:]))
+	return time.Unix(sec, frac*1e9>>32)
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:], uint32(int64(t.Nanosecond())<<32/1e9))
+}
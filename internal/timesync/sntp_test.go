@@ -0,0 +1,80 @@
+package timesync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/sim"
+)
+
+// local round trips are well under this
+const tolerance = 50 * time.Millisecond
+
+var offsets = []time.Duration{0, 90 * time.Second, -3 * time.Hour, 1234 * time.Millisecond}
+
+func checkOffset(t *testing.T, src Source, want time.Duration) {
+	t.Helper()
+
+	got, err := src.Offset(context.Background())
+	if err != nil {
+		t.Fatalf("offset %s: %v", want, err)
+	}
+	if d := got - want; d > tolerance || d < -tolerance {
+		t.Errorf("got offset %s, want %s", got, want)
+	}
+}
+
+func TestSNTPOffset(t *testing.T) {
+	s, err := sim.NewSNTPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	src := &SNTP{Server: s.Addr}
+	for _, want := range offsets {
+		s.SetClockOffset(want)
+		checkOffset(t, src, want)
+	}
+}
+
+func TestSNTPNoServer(t *testing.T) {
+	s, err := sim.NewSNTPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close() // nothing answers on its port
+
+	src := &SNTP{Server: s.Addr, Timeout: 200 * time.Millisecond}
+	if _, err = src.Offset(context.Background()); err == nil {
+		t.Error("no error without server")
+	}
+}
+
+func TestHTTPOffset(t *testing.T) {
+	s := sim.NewResultServer()
+	defer s.Close()
+
+	src := &HTTP{URL: s.TimeURL()}
+	for _, want := range offsets {
+		s.SetClockOffset(want)
+		checkOffset(t, src, want)
+	}
+
+	s.SetDown(true)
+	if _, err := src.Offset(context.Background()); err == nil {
+		t.Error("no error while server is down")
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	sent := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	received := sent.Add(200 * time.Millisecond)
+
+	// 12:00:05 at second resolution is 12:00:05.5 on average, read at 12:00:00.1 local
+	ref := time.Date(2024, 1, 1, 12, 0, 5, 0, time.UTC)
+	if got, want := Estimate(ref, sent, received, time.Second), 5400*time.Millisecond; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,38 @@
+// Package timesync measures the offset of a reference clock from the local clock.
+package timesync
+
+import (
+	"context"
+	"time"
+
+	"github.com/RoanBrand/SpectroMonitor/internal/http"
+)
+
+// Source of reference time.
+type Source interface {
+	// Offset returns reference clock minus local clock.
+	Offset(ctx context.Context) (time.Duration, error)
+}
+
+// Estimate offset of refTime, read by the reference between local times sent and received.
+// Assumes reference read its clock halfway through the round trip,
+// and halfway through its clock's resolution.
+func Estimate(refTime, sent, received time.Time, resolution time.Duration) time.Duration {
+	mid := sent.Add(received.Sub(sent) / 2)
+	return refTime.Add(resolution / 2).Sub(mid)
+}
+
+// HTTP source is our JSON /gettime endpoint, e.g. time_update_url.
+type HTTP struct {
+	URL string
+}
+
+func (s *HTTP) Offset(ctx context.Context) (time.Duration, error) {
+	sent := time.Now()
+	t, err := http.GetTime(s.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	return Estimate(t, sent, time.Now(), 0), nil
+}
@@ -19,6 +19,7 @@ const usageMsg = "Specify config -c=config.json"
 func main() {
 	svcFlag := flag.String("service", "", "Control the system service.")
 	confFlag := flag.String("c", "", usageMsg)
+	checkFlag := flag.Bool("check-config", false, "Validate config and exit. Exits non-zero on errors.")
 	flag.Parse()
 
 	if *confFlag == "" {
@@ -30,7 +31,12 @@ func main() {
 		log.Fatal("error parsing config '"+*confFlag+"': ", err)
 	}
 
-	gracefulStop := make(chan os.Signal)
+	if *checkFlag {
+		log.Println("config '" + *confFlag + "' is valid")
+		return
+	}
+
+	gracefulStop := make(chan os.Signal, 1)
 	signal.Notify(gracefulStop, syscall.SIGTERM)
 	signal.Notify(gracefulStop, syscall.SIGINT)
 	go func() {
@@ -48,7 +54,7 @@ func main() {
 		Description: "Powers light indications & time display boards",
 	}
 
-	s, err := service.New(spectromon.New(conf), svcConfig)
+	s, err := service.New(spectromon.New(conf, *confFlag), svcConfig)
 	if err != nil {
 		log.Fatal(err)
 	}